@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+)
+
+// powerAction is an action clients can request, either on its own path or
+// by name through /api/v1/actions. Both routes dispatch through runAction.
+type powerAction struct {
+	name string
+	// aliases are other names /api/v1/actions accepts for the action.
+	aliases     []string
+	path        string
+	description string
+	// available reports whether this host can run the action at all; nil
+	// means it always can on Windows.
+	available func() bool
+	// command picks the command to run and the message reported when it has
+	// been staged.
+	command func() (powerCommand, string)
+	// run replaces the usual checks and command for an action that needs
+	// more from the request than a delay, such as a boot entry.
+	run func(w http.ResponseWriter, r *http.Request, req actionRequest)
+}
+
+var actionTable = []powerAction{
+	{
+		name:        "shutdown",
+		path:        "/shutdown",
+		description: "Power the machine off.",
+		command: func() (powerCommand, string) {
+			return power.Shutdown, "Shutdown command staged. The machine is powering off."
+		},
+	},
+	{
+		name:        "restart",
+		path:        "/restart",
+		description: "Restart the machine.",
+		command: func() (powerCommand, string) {
+			return power.Restart, "Restart command staged. The machine is restarting."
+		},
+	},
+	{
+		name:        "restart-update",
+		path:        "/restart-update",
+		description: "Install staged Windows updates and restart, or restart plainly when none are staged.",
+		command: func() (powerCommand, string) {
+			ready, err := updatesReadyToInstall()
+			if err != nil {
+				log.Printf("check for staged updates: %v", err)
+			}
+			if !ready {
+				return power.Restart, "Warning: no updates are staged for installation, so a plain restart was staged instead. The machine is restarting."
+			}
+			return power.RestartInstallUpdates, "Update and restart staged. Windows will install pending updates and restart."
+		},
+	},
+	{
+		name:        "restart-bios",
+		aliases:     []string{"restart-firmware"},
+		path:        "/restart-bios",
+		description: "Restart into the UEFI firmware setup.",
+		available:   bootedFromUEFI,
+		command: func() (powerCommand, string) {
+			return bitLockerCommand(power.RestartFirmware), "Firmware restart command staged. The machine will reboot into BIOS/UEFI."
+		},
+	},
+	{
+		name:        "restart-recovery",
+		path:        "/restart-recovery",
+		description: "Restart into the Windows Recovery Environment.",
+		command: func() (powerCommand, string) {
+			return power.RestartRecovery, "Recovery restart staged. The machine will reboot into the Windows Recovery Environment."
+		},
+	},
+	{
+		name:        "restart-safemode",
+		path:        "/restart-safemode",
+		description: "Restart into safe mode, with networking when network is true. The flag is cleared again at the following startup.",
+		command: func() (powerCommand, string) {
+			return bitLockerCommand(safeModeRestart), "Safe mode restart staged. The machine will restart into safe mode once; a startup task switches the following boot back to normal."
+		},
+	},
+	{
+		name:        "restart-boot-entry",
+		path:        "/api/firmware/bootnext",
+		description: "Restart into the UEFI boot entry named by bootEntry, once. GET /api/firmware/bootoptions lists the entries.",
+		available:   bootedFromUEFI,
+		run:         bootNextRestart,
+	},
+	{
+		name:        "sleep",
+		path:        "/sleep",
+		description: "Put the machine to sleep.",
+		available:   func() bool { return suspendAllowed(false) },
+		command: func() (powerCommand, string) {
+			return suspendCommand(false), "Sleep staged. The machine is going to sleep."
+		},
+	},
+	{
+		name:        "hibernate",
+		path:        "/hibernate",
+		description: "Hibernate the machine.",
+		available:   func() bool { return suspendAllowed(true) },
+		command: func() (powerCommand, string) {
+			return suspendCommand(true), "Hibernate staged. The machine is hibernating."
+		},
+	},
+	{
+		name:        "lock",
+		path:        "/lock",
+		description: "Lock the console session.",
+		command: func() (powerCommand, string) {
+			return sessionCommand("lock", lockConsoleSession), "Lock staged. The console session will return to the lock screen."
+		},
+	},
+	{
+		name:        "logoff",
+		path:        "/logoff",
+		description: "Sign out the user at the console.",
+		command: func() (powerCommand, string) {
+			return sessionCommand("logoff", logoffConsoleSession), "Sign-out staged. The user at the console will be signed out."
+		},
+	},
+}
+
+func lookupAction(name string) (powerAction, bool) {
+	for _, action := range actionTable {
+		if action.name == name || slices.Contains(action.aliases, name) {
+			return action, true
+		}
+	}
+	return powerAction{}, false
+}
+
+// actionInfo is one entry of GET /api/v1/actions.
+type actionInfo struct {
+	Action string `json:"action"`
+	// Aliases are other names POST /api/v1/actions accepts for it.
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"description"`
+	// Endpoint is the action's own path, which accepts the same body
+	// without the action field.
+	Endpoint string `json:"endpoint"`
+	// BlockedByPolicy names the Group Policy that currently refuses the
+	// action, if any.
+	BlockedByPolicy string `json:"blockedByPolicy,omitempty"`
+}
+
+type actionList struct {
+	Actions []actionInfo `json:"actions"`
+}
+
+// actionResult is the response to an action that was staged.
+type actionResult struct {
+	Action           string `json:"action"`
+	Message          string `json:"message"`
+	ScheduledAt      string `json:"scheduledAt"`
+	SecondsRemaining int    `json:"secondsRemaining"`
+	Attempts         int    `json:"attempts"`
+}
+
+// actionError documents the fields an action can fail with. Error is always
+// set; the others only accompany the codes they explain.
+type actionError struct {
+	Message string `json:"message"`
+	// Error is a stable code such as unsupported_platform, invalid_delay,
+	// invalid_confirmation or exec_failed.
+	Error string `json:"error"`
+	// ErrorCode is the Win32 error behind exec_failed, when Windows
+	// reported one.
+	ErrorCode             int    `json:"errorCode,omitempty"`
+	Attempts              int    `json:"attempts,omitempty"`
+	InFlight              string `json:"inFlight,omitempty"`
+	Policy                string `json:"policy,omitempty"`
+	ExternalRebootPending bool   `json:"externalRebootPending,omitempty"`
+	// PendingAction names this server's own delayed action when it is the
+	// shutdown already scheduled.
+	PendingAction string `json:"pendingAction,omitempty"`
+}
+
+// availableActions lists the actions this host can run. Actions blocked by
+// policy stay listed, flagged, since an administrator can lift the policy.
+func availableActions() []actionInfo {
+	infos := []actionInfo{}
+	if !powerControlAvailable {
+		return infos
+	}
+	for _, action := range actionTable {
+		if action.available != nil && !action.available() {
+			continue
+		}
+		info := actionInfo{Action: action.name, Aliases: action.aliases, Description: action.description, Endpoint: action.path}
+		if restriction, restricted := restrictionFor(action.name); restricted {
+			info.BlockedByPolicy = restriction.Policy
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// actionPathHandler serves an action's own path.
+func actionPathHandler(action powerAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !checkPowerPlatform(w) {
+			return
+		}
+		req, err := parseActionRequest(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		// The path already names the action; a body naming another one is
+		// a client bug, not something to guess about.
+		if req.Action != "" && req.Action != action.name && !slices.Contains(action.aliases, req.Action) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": fmt.Sprintf("%s runs %q, but the body asks for %q. Leave action out, or POST to /api/v1/actions.", action.path, action.name, req.Action),
+				"error":   "invalid_request",
+			})
+			return
+		}
+		runAction(w, r, action, req)
+	}
+}
+
+// actionsV1Handler lists the available actions on GET and runs the one
+// named in the body on POST.
+func actionsV1Handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, actionList{Actions: availableActions()})
+	case http.MethodPost:
+		if !checkPowerPlatform(w) {
+			return
+		}
+		req, err := parseActionRequest(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		action, ok := lookupAction(req.Action)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": fmt.Sprintf("Unknown action %q. GET /api/v1/actions lists the actions this host supports.", req.Action),
+				"error":   "unknown_action",
+			})
+			return
+		}
+		runAction(w, r, action, req)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// runAction checks policy, claims the command guard, checks confirmation and
+// stages action. The guard comes first so a request turned away because
+// another command is running doesn't spend its confirmation token.
+func runAction(w http.ResponseWriter, r *http.Request, action powerAction, req actionRequest) {
+	if action.run != nil {
+		action.run(w, r, req)
+		return
+	}
+	if !checkPolicy(w, action.name) {
+		return
+	}
+	if !claimPowerCommand(w, action.name) {
+		return
+	}
+	defer powerCommands.release()
+	if !confirmAction(w, action.name, req) {
+		return
+	}
+
+	command, message := action.command()
+	executePowerAction(w, r, action.name, req, command, message)
+}
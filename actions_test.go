@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestActionTableIsConsistent(t *testing.T) {
+	names := make(map[string]bool)
+	paths := make(map[string]bool)
+	for _, action := range actionTable {
+		if names[action.name] || paths[action.path] {
+			t.Errorf("%s (%s) is listed twice", action.name, action.path)
+		}
+		names[action.name], paths[action.path] = true, true
+		if action.description == "" || (action.command == nil) == (action.run == nil) {
+			t.Errorf("%s needs a description and exactly one of command and run", action.name)
+		}
+		if found, ok := lookupAction(action.name); !ok || found.path != action.path {
+			t.Errorf("lookupAction(%q) = %v, %v", action.name, found.path, ok)
+		}
+	}
+	// Names clients already depend on.
+	for _, name := range []string{"shutdown", "restart", "restart-update", "restart-bios", "restart-boot-entry", "sleep", "hibernate"} {
+		if !names[name] {
+			t.Errorf("action %q is gone", name)
+		}
+	}
+}
+
+// TestActionRouting arms every action through both of its routes, which
+// exercises routing and naming without running any command.
+func TestActionRouting(t *testing.T) {
+	fake := useFakePower(t)
+	fake.boot.options = []bootOption{{ID: "0003", Description: "Ubuntu", Active: true}}
+	requireConfirmation = true
+	t.Cleanup(func() { requireConfirmation = false })
+
+	for _, action := range actionTable {
+		t.Run(action.name, func(t *testing.T) {
+			routes := []struct{ path, body string }{
+				{action.path, `{"delaySeconds": 60, "bootEntry": "0003"}`},
+				{"/api/v1/actions", fmt.Sprintf(`{"action": %q, "delaySeconds": 60, "bootEntry": "0003"}`, action.name)},
+			}
+			for _, route := range routes {
+				rec := serve(t, http.MethodPost, route.path, route.body)
+				if rec.Code != http.StatusAccepted {
+					t.Fatalf("%s: %d %s, want 202", route.path, rec.Code, rec.Body)
+				}
+				if got := decodeBody(t, rec)["action"]; got != action.name {
+					t.Errorf("%s: action = %v, want %s", route.path, got, action.name)
+				}
+			}
+		})
+	}
+	if calls := fake.called(); len(calls) != 0 {
+		t.Errorf("arming ran commands: %v", calls)
+	}
+}
+
+func TestActionPathRejectsAnotherAction(t *testing.T) {
+	fake := useFakePower(t)
+	for _, action := range actionTable {
+		other := "restart"
+		if action.name == other {
+			other = "shutdown"
+		}
+		rec := serve(t, http.MethodPost, action.path, fmt.Sprintf(`{"action": %q}`, other))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s with action %q: %d, want 400", action.path, other, rec.Code)
+		}
+	}
+	// Naming the path's own action is harmless.
+	if rec := serve(t, http.MethodPost, "/shutdown", `{"action": "shutdown"}`); rec.Code != http.StatusOK {
+		t.Errorf("/shutdown with its own action: %d %s", rec.Code, rec.Body)
+	}
+	if calls := fake.called(); len(calls) != 1 || calls[0] != "shutdown" {
+		t.Errorf("calls = %v, want [shutdown]", calls)
+	}
+}
+
+func TestActionsV1UnknownAction(t *testing.T) {
+	useFakePower(t)
+	rec := serve(t, http.MethodPost, "/api/v1/actions", `{"action": "explode"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("%d %s, want 400", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["error"]; got != "unknown_action" {
+		t.Errorf("error = %v, want unknown_action", got)
+	}
+}
+
+func TestActionsV1Aliases(t *testing.T) {
+	fake := useFakePower(t)
+	rec := serve(t, http.MethodPost, "/api/v1/actions", `{"action": "restart-firmware"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%d %s, want 200", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["action"]; got != "restart-bios" {
+		t.Errorf("action = %v, want restart-bios", got)
+	}
+	if calls := fake.called(); len(calls) != 1 || calls[0] != "restart-firmware" {
+		t.Errorf("calls = %v, want [restart-firmware]", calls)
+	}
+
+	request := openAPIDocument()["components"].(map[string]interface{})["schemas"].(map[string]interface{})["ActionRequest"].(map[string]interface{})
+	names := request["properties"].(map[string]interface{})["action"].(map[string]interface{})["enum"].([]string)
+	for _, name := range []string{"restart-bios", "restart-firmware", "restart-boot-entry"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("the OpenAPI action enum %v leaves out %q", names, name)
+		}
+	}
+}
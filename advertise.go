@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// advertisedURLs returns the URLs clients can use to reach a server bound
+// to listenAddr, best first. A wildcard bind is expanded to the host's
+// addresses: global IPv6, then private IPv4, unique-local IPv6 and other
+// IPv4. Link-local addresses only appear when nothing else exists, and then
+// carry their zone so the URL is actually usable.
+func advertisedURLs(scheme, listenAddr string) []string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return nil
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return []string{formatURL(scheme, host, "", port)}
+	}
+
+	var urls []string
+	for _, a := range advertisedAddrs(interfaceAddrs()) {
+		urls = append(urls, formatURL(scheme, a.ip.String(), a.zone, port))
+	}
+	return urls
+}
+
+// interfaceAddr is an address of an up, non-loopback interface; zone is the
+// interface name.
+type interfaceAddr struct {
+	ip   net.IP
+	zone string
+}
+
+func interfaceAddrs() []interfaceAddr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var all []interfaceAddr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				all = append(all, interfaceAddr{ip: ipNet.IP, zone: iface.Name})
+			}
+		}
+	}
+	return all
+}
+
+// advertisedAddrs picks and orders the addresses worth advertising. Only
+// link-local IPv6 addresses keep their zone, since nothing else needs one.
+func advertisedAddrs(all []interfaceAddr) []interfaceAddr {
+	type candidate struct {
+		interfaceAddr
+		rank int
+	}
+	var candidates, linkLocal []candidate
+	for _, a := range all {
+		switch {
+		case a.ip.IsLinkLocalUnicast():
+			if a.ip.To4() == nil {
+				linkLocal = append(linkLocal, candidate{interfaceAddr: a})
+			}
+		case a.ip.IsGlobalUnicast():
+			candidates = append(candidates, candidate{interfaceAddr: interfaceAddr{ip: a.ip}, rank: addressRank(a.ip)})
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = linkLocal
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	picked := make([]interfaceAddr, len(candidates))
+	for i, c := range candidates {
+		picked[i] = c.interfaceAddr
+	}
+	return picked
+}
+
+// addressRank orders global unicast addresses by how useful they are to
+// advertise; lower is better.
+func addressRank(ip net.IP) int {
+	isV4 := ip.To4() != nil
+	switch {
+	case !isV4 && !ip.IsPrivate():
+		return 0
+	case isV4 && ip.IsPrivate():
+		return 1
+	case !isV4:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// formatURL brackets IPv6 literals and percent-encodes the zone separator
+// as RFC 6874 requires.
+func formatURL(scheme, host, zone, port string) string {
+	if zone != "" {
+		host += "%25" + zone
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host + ":" + port
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestFormatURL(t *testing.T) {
+	tests := []struct {
+		host, zone, want string
+	}{
+		{"192.168.1.10", "", "http://192.168.1.10:8181"},
+		{"myhost", "", "http://myhost:8181"},
+		{"2001:db8::1", "", "http://[2001:db8::1]:8181"},
+		{"fe80::1", "eth0", "http://[fe80::1%25eth0]:8181"},
+		{"fe80::1", "Ethernet 2", "http://[fe80::1%25Ethernet 2]:8181"},
+	}
+	for _, tt := range tests {
+		if got := formatURL("http", tt.host, tt.zone, "8181"); got != tt.want {
+			t.Errorf("formatURL(%q, %q) = %s, want %s", tt.host, tt.zone, got, tt.want)
+		}
+	}
+}
+
+func TestAddressRank(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"2001:db8::1", 0},
+		{"192.168.1.10", 1},
+		{"10.0.0.5", 1},
+		{"fd00::5", 2},
+		{"203.0.113.7", 3},
+	}
+	for _, tt := range tests {
+		if got := addressRank(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("addressRank(%s) = %d, want %d", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAdvertisedAddrs(t *testing.T) {
+	addrs := func(ips ...string) []interfaceAddr {
+		var all []interfaceAddr
+		for _, ip := range ips {
+			all = append(all, interfaceAddr{ip: net.ParseIP(ip), zone: "eth0"})
+		}
+		return all
+	}
+	tests := []struct {
+		name string
+		all  []interfaceAddr
+		want []string
+	}{
+		{
+			"ordered by rank, stable within a rank",
+			addrs("203.0.113.7", "fd00::5", "10.0.0.5", "2001:db8::1", "192.168.1.10"),
+			[]string{"2001:db8::1", "10.0.0.5", "192.168.1.10", "fd00::5", "203.0.113.7"},
+		},
+		{
+			"link-local hidden when something better exists",
+			addrs("fe80::1", "192.168.1.10", "169.254.3.4"),
+			[]string{"192.168.1.10"},
+		},
+		{
+			"link-local IPv6 as a last resort, with its zone",
+			addrs("169.254.3.4", "fe80::1"),
+			[]string{"fe80::1%eth0"},
+		},
+		{"nothing usable", addrs("169.254.3.4"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range advertisedAddrs(tt.all) {
+				s := a.ip.String()
+				if a.zone != "" {
+					s += "%" + a.zone
+				}
+				got = append(got, s)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("advertisedAddrs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvertisedURLsForExplicitHost(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   []string
+	}{
+		{"192.168.1.10:8181", []string{"https://192.168.1.10:8181"}},
+		{"[2001:db8::1]:8443", []string{"https://[2001:db8::1]:8443"}},
+		{"myhost:8181", []string{"https://myhost:8181"}},
+		{"no-port", nil},
+	}
+	for _, tt := range tests {
+		if got := advertisedURLs("https", tt.listen); !slices.Equal(got, tt.want) {
+			t.Errorf("advertisedURLs(%q) = %v, want %v", tt.listen, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientAllowlist limits which client addresses may use the server.
+type clientAllowlist struct {
+	prefixes []netip.Prefix
+	// trustProxy takes the client from X-Forwarded-For instead of the
+	// connection, for servers behind a reverse proxy. The header is only
+	// honoured from loopback and the proxies listed in proxies.
+	trustProxy bool
+	proxies    []netip.Prefix
+	// restrictPage applies the list to GET / as well as the API.
+	restrictPage bool
+	// publicMetrics exempts /metrics from the list.
+	publicMetrics bool
+}
+
+// serverAllowlist is the allowlist the server runs with. Handlers resolve
+// client addresses through it, so records name the same client the
+// allowlist checked rather than a reverse proxy.
+var serverAllowlist clientAllowlist
+
+func newClientAllowlist(cfg config) (clientAllowlist, error) {
+	prefixes, err := parseAllowedClients(cfg.AllowedClients)
+	if err != nil {
+		return clientAllowlist{}, err
+	}
+	proxies, err := parseAllowedClients(cfg.TrustedProxies)
+	if err != nil {
+		return clientAllowlist{}, err
+	}
+	return clientAllowlist{
+		prefixes:      prefixes,
+		trustProxy:    cfg.TrustProxy,
+		proxies:       proxies,
+		restrictPage:  cfg.RestrictPage,
+		publicMetrics: cfg.PublicMetrics,
+	}, nil
+}
+
+// parseAllowedClients accepts single addresses ("192.168.1.20", "fe80::1")
+// and CIDR ranges ("192.168.1.0/24", "2001:db8::/32").
+func parseAllowedClients(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed client %q: %w", entry, err)
+			}
+			if prefix.Addr().Is4In6() {
+				prefix = netip.PrefixFrom(prefix.Addr().Unmap(), max(prefix.Bits()-96, 0))
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed client %q: %w", entry, err)
+		}
+		addr = addr.Unmap().WithZone("")
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// allows reports whether addr may use the server. Loopback is always
+// allowed so the machine itself can't be locked out.
+func (a clientAllowlist) allows(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	return addr.IsLoopback() || prefixesContain(a.prefixes, addr)
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr is the address a request came from. With trustProxy, and only
+// when the connection comes from loopback or a trusted proxy, the rightmost
+// X-Forwarded-For entry wins: it was appended by the proxy itself, while
+// anything to its left is whatever the client chose to send. A client
+// connecting directly can't claim to be loopback that way.
+func (a clientAllowlist) clientAddr(r *http.Request) (netip.Addr, error) {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address %q", r.RemoteAddr)
+	}
+	peer := addrPort.Addr().Unmap()
+	if !a.trustProxy {
+		return peer, nil
+	}
+	if bare := peer.WithZone(""); !bare.IsLoopback() && !prefixesContain(a.proxies, bare) {
+		return peer, nil
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return peer, nil
+	}
+	hops := strings.Split(forwarded[len(forwarded)-1], ",")
+	hop := strings.TrimSpace(hops[len(hops)-1])
+	addr, err := netip.ParseAddr(hop)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid X-Forwarded-For address %q", hop)
+	}
+	return addr.Unmap(), nil
+}
+
+// allowClients rejects requests from addresses outside allowlist with 403.
+// An empty list disables the check.
+func allowClients(allowlist clientAllowlist, next http.Handler) http.Handler {
+	if len(allowlist.prefixes) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && !allowlist.restrictPage || r.URL.Path == "/metrics" && allowlist.publicMetrics {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr, err := allowlist.clientAddr(r)
+		if err != nil || !allowlist.allows(addr) {
+			client := addr.String()
+			if err != nil {
+				client = err.Error()
+			}
+			log.Printf("denied %s %s from %s (not in allowedClients)", r.Method, r.URL.Path, client)
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"message": "This client address is not allowed to use WindowsControl.",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestAllowlistAllows(t *testing.T) {
+	prefixes, err := parseAllowedClients([]string{"192.168.1.0/24", "100.64.0.7", "fd7a:115c:a1e0::/48", "::ffff:10.0.0.0/104"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowlist := clientAllowlist{prefixes: prefixes}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"192.168.1.1", true},
+		{"192.168.1.255", true},
+		{"192.168.2.1", false},
+		{"100.64.0.7", true},
+		{"100.64.0.8", false},
+		{"fd7a:115c:a1e0:ab12::1", true},
+		{"fd7a:115c:a1e1::1", false},
+		{"::ffff:192.168.1.9", true},
+		{"10.200.0.1", true},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.allows(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("allows(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParseAllowedClientsRejectsGarbage(t *testing.T) {
+	for _, entry := range []string{"192.168.1.0/33", "not-an-ip", "10.0.0.0/"} {
+		if _, err := parseAllowedClients([]string{entry}); err == nil {
+			t.Errorf("parseAllowedClients(%q) succeeded", entry)
+		}
+	}
+}
+
+func TestClientAddrProxyTrust(t *testing.T) {
+	proxies, err := parseAllowedClients([]string{"10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remote     string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxy trust ignores header", false, "192.168.1.50:4000", []string{"127.0.0.1"}, "192.168.1.50"},
+		{"direct client can't spoof loopback", true, "192.168.1.50:4000", []string{"127.0.0.1"}, "192.168.1.50"},
+		{"loopback proxy is honoured", true, "127.0.0.1:4000", []string{"192.168.1.50"}, "192.168.1.50"},
+		{"configured proxy is honoured", true, "10.0.0.2:4000", []string{"192.168.1.50"}, "192.168.1.50"},
+		{"rightmost hop wins", true, "10.0.0.2:4000", []string{"127.0.0.1, 192.168.1.50"}, "192.168.1.50"},
+		{"last header wins", true, "10.0.0.2:4000", []string{"127.0.0.1", "192.168.1.50"}, "192.168.1.50"},
+		{"proxy without header", true, "10.0.0.2:4000", nil, "10.0.0.2"},
+		{"ipv6 loopback proxy", true, "[::1]:4000", []string{"fd7a::5"}, "fd7a::5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlist := clientAllowlist{trustProxy: tt.trustProxy, proxies: proxies}
+			r := httptest.NewRequest(http.MethodGet, "/status", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			got, err := allowlist.clientAddr(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("clientAddr = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAddrRejectsBadForwardedHop(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/status", nil)
+	r.RemoteAddr = "127.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "nonsense")
+	if _, err := (clientAllowlist{trustProxy: true}).clientAddr(r); err == nil {
+		t.Fatal("clientAddr accepted an unparseable X-Forwarded-For hop")
+	}
+}
+
+func TestAllowClients(t *testing.T) {
+	prefixes, err := parseAllowedClients([]string{"192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name         string
+		path         string
+		remote       string
+		restrictPage bool
+		want         int
+	}{
+		{"listed client", "/status", "192.168.1.20:1000", false, http.StatusOK},
+		{"unlisted client", "/status", "10.1.1.1:1000", false, http.StatusForbidden},
+		{"page stays open", "/", "10.1.1.1:1000", false, http.StatusOK},
+		{"restricted page", "/", "10.1.1.1:1000", true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := allowClients(clientAllowlist{prefixes: prefixes, restrictPage: tt.restrictPage}, ok)
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.RemoteAddr = tt.remote
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
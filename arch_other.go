@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "runtime"
+
+func nativeArch() (string, error) {
+	return runtime.GOARCH, nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package main
+
+import (
+	"debug/pe"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// nativeArch reports the GOARCH name of the machine's native architecture,
+// which differs from runtime.GOARCH when the binary runs under WOW64 or
+// x64-on-ARM64 emulation.
+func nativeArch() (string, error) {
+	var processMachine, nativeMachine uint16
+	if err := windows.IsWow64Process2(windows.CurrentProcess(), &processMachine, &nativeMachine); err != nil {
+		return "", err
+	}
+	switch nativeMachine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64", nil
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386", nil
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64", nil
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm", nil
+	}
+	return "", fmt.Errorf("unrecognized native machine type %#x", nativeMachine)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxAtHorizon caps how far ahead an "at" time may be.
+const maxAtHorizon = 24 * time.Hour
+
+// resolveAt converts an "at" value into whole seconds from now. RFC3339
+// timestamps are used as given; "HH:MM" is the next occurrence of that
+// wall-clock time on this machine, rolling over to tomorrow once today's
+// has passed.
+func resolveAt(value string, now time.Time) (int, error) {
+	var fireAt time.Time
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		fireAt = t
+	} else if clock, err := time.Parse("15:04", value); err == nil {
+		today := now.Local()
+		fireAt = time.Date(today.Year(), today.Month(), today.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		if !fireAt.After(now) {
+			fireAt = time.Date(today.Year(), today.Month(), today.Day()+1, clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		}
+	} else {
+		return 0, fmt.Errorf("invalid at %q: use an RFC3339 timestamp or a local HH:MM time", value)
+	}
+
+	delay := fireAt.Sub(now)
+	if delay <= 0 {
+		return 0, fmt.Errorf("at %q is in the past", value)
+	}
+	if delay > maxAtHorizon {
+		return 0, fmt.Errorf("at %q is more than %d hours away", value, int(maxAtHorizon.Hours()))
+	}
+	seconds := int(delay.Round(time.Second) / time.Second)
+	if seconds == 0 {
+		// A zero delay would run the action immediately, which is not what
+		// a client naming a time asked for.
+		return 0, fmt.Errorf("at %q is less than a second away", value)
+	}
+	return seconds, nil
+}
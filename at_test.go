@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResolveAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		at      string
+		want    int
+		wantErr bool
+	}{
+		{"rfc3339", now.Add(90 * time.Minute).Format(time.RFC3339), 90 * 60, false},
+		{"rfc3339 with offset", now.UTC().Add(time.Hour).In(time.FixedZone("", 5*3600)).Format(time.RFC3339), 3600, false},
+		{"clock later today", "13:30", 90 * 60, false},
+		{"clock rolls over to tomorrow", "11:00", 23 * 3600, false},
+		{"clock equal to now rolls over", "12:00", 24 * 3600, false},
+		{"past rfc3339", now.Add(-time.Minute).Format(time.RFC3339), 0, true},
+		{"more than 24h away", now.Add(25 * time.Hour).Format(time.RFC3339), 0, true},
+		{"exactly 24h away", now.Add(24 * time.Hour).Format(time.RFC3339), 24 * 3600, false},
+		{"bad format", "tomorrow", 0, true},
+		{"clock out of range", "25:00", 0, true},
+		{"clock with seconds", "12:30:00", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAt(tt.at, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAt(%q) error = %v, wantErr %v", tt.at, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveAt(%q) = %d, want %d", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAtRejectsZeroDelay(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, ahead := range []time.Duration{time.Millisecond, 499 * time.Millisecond} {
+		if seconds, err := resolveAt(at.Format(time.RFC3339), at.Add(-ahead)); err == nil {
+			t.Errorf("an at %s away resolved to %d seconds", ahead, seconds)
+		}
+	}
+	if seconds, err := resolveAt(at.Format(time.RFC3339), at.Add(-600*time.Millisecond)); err != nil || seconds != 1 {
+		t.Errorf("an at 600ms away = %d, %v, want 1 second", seconds, err)
+	}
+}
+
+func TestActionRejectsBothDelayAndAt(t *testing.T) {
+	fake := useFakePower(t)
+	rec := serve(t, http.MethodPost, "/shutdown", `{"delaySeconds": 60, "at": "23:00"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("%d %s, want 400", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["error"]; got != "invalid_delay" {
+		t.Errorf("error = %v, want invalid_delay", got)
+	}
+	if calls := fake.called(); len(calls) != 0 {
+		t.Errorf("calls = %v", calls)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	auditFileName = "audit.jsonl"
+	// defaultAuditMaxBytes is the size at which the audit log is rotated.
+	// One rotated generation is kept next to it as audit.jsonl.1.
+	defaultAuditMaxBytes = 1 << 20
+
+	defaultAuditLimit = 50
+	maxAuditLimit     = 1000
+)
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action,omitempty"`
+	// Outcome is "requested" just before a command runs, then "staged",
+	// "rejected" or "failed"; an abort records "cancelled".
+	Outcome      string `json:"outcome"`
+	DelaySeconds int    `json:"delaySeconds"`
+	// Attempts is how many times the command ran, on the entry recording
+	// how it ended.
+	Attempts  int    `json:"attempts,omitempty"`
+	Client    string `json:"client"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// auditLog appends entries to a JSON-lines file and answers queries over it.
+type auditLog struct {
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// audit is nil until main opens the log; recording to it is then a no-op.
+var audit *auditLog
+
+func newAuditLog(path string, maxBytes int64) *auditLog {
+	if maxBytes <= 0 {
+		maxBytes = defaultAuditMaxBytes
+	}
+	return &auditLog{path: path, maxBytes: maxBytes}
+}
+
+// record appends an entry for the request r; attempts is 0 when no command
+// has run yet. A write failure is logged but doesn't stop the action:
+// refusing to reboot because the disk is full would be worse than a gap in
+// the log.
+func (a *auditLog) record(r *http.Request, action, outcome string, delaySeconds, attempts int) {
+	if a == nil {
+		return
+	}
+	entry := auditEntry{
+		Time:         time.Now().UTC(),
+		Action:       action,
+		Outcome:      outcome,
+		DelaySeconds: delaySeconds,
+		Attempts:     attempts,
+		Client:       requestClient(r),
+		UserAgent:    r.UserAgent(),
+	}
+	if err := a.append(entry); err != nil {
+		log.Printf("audit log: %v", err)
+	}
+}
+
+// append writes entry and syncs it to disk before returning, so the entry
+// for a shutdown survives the shutdown itself.
+func (a *auditLog) append(entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *auditLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file, a.size = f, info.Size()
+	return nil
+}
+
+// rotate moves the current file to path.1, replacing the previous
+// generation, and starts a new one. The file is closed first because
+// Windows can't rename an open file.
+func (a *auditLog) rotate() error {
+	err := a.file.Close()
+	a.file = nil
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+// query returns up to limit entries at or after since, newest first.
+func (a *auditLog) query(since time.Time, limit int) ([]auditEntry, error) {
+	entries := []auditEntry{}
+	if a == nil {
+		return entries, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, path := range []string{a.path + ".1", a.path} {
+		read, err := readAuditFile(path, since)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, read...)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// readAuditFile reads the entries of one generation in file order. A line
+// that doesn't parse, such as one torn by a power loss, is skipped.
+func readAuditFile(path string, since time.Time) ([]auditEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// auditHandler serves GET /audit?limit=N&since=RFC3339.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultAuditLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeRequestError(w, fmt.Errorf("limit must be a whole number from 1 to %d", maxAuditLimit))
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeRequestError(w, errors.New("since must be an RFC3339 timestamp such as 2024-05-01T02:00:00Z"))
+			return
+		}
+		since = t
+	}
+	entries, err := audit.query(since, limit)
+	if err != nil {
+		log.Printf("read audit log: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to read the audit log.",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
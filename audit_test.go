@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestAuditLog(t *testing.T, maxBytes int64) *auditLog {
+	t.Helper()
+	a := newAuditLog(filepath.Join(t.TempDir(), auditFileName), maxBytes)
+	t.Cleanup(func() {
+		if a.file != nil {
+			a.file.Close()
+		}
+	})
+	return a
+}
+
+func TestAuditConcurrentWrites(t *testing.T) {
+	a := newTestAuditLog(t, 0)
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				r := httptest.NewRequest(http.MethodPost, "/shutdown", nil)
+				a.record(r, fmt.Sprintf("action-%d", i), "requested", j, 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := a.query(time.Time{}, maxAuditLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != writers*perWriter {
+		t.Fatalf("read %d entries, want %d", len(entries), writers*perWriter)
+	}
+	seen := map[string]int{}
+	for _, entry := range entries {
+		seen[entry.Action]++
+	}
+	for i := 0; i < writers; i++ {
+		if got := seen[fmt.Sprintf("action-%d", i)]; got != perWriter {
+			t.Errorf("action-%d has %d entries, want %d", i, got, perWriter)
+		}
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	a := newTestAuditLog(t, 0)
+	base := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		entry := auditEntry{Time: base.Add(time.Duration(i) * time.Hour), Action: fmt.Sprintf("a%d", i), Outcome: "staged"}
+		if err := a.append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		since time.Time
+		limit int
+		want  []string
+	}{
+		{"all newest first", time.Time{}, 10, []string{"a4", "a3", "a2", "a1", "a0"}},
+		{"limit keeps the newest", time.Time{}, 2, []string{"a4", "a3"}},
+		{"since is inclusive", base.Add(3 * time.Hour), 10, []string{"a4", "a3"}},
+		{"since and limit", base.Add(time.Hour), 1, []string{"a4"}},
+		{"since after everything", base.Add(24 * time.Hour), 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := a.query(tt.since, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Action)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("query = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	const maxBytes = 512
+	a := newTestAuditLog(t, maxBytes)
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	const total = 40
+	for i := 0; i < total; i++ {
+		if err := a.append(auditEntry{Time: base.Add(time.Duration(i) * time.Second), Action: fmt.Sprintf("a%d", i), Outcome: "staged"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{a.path, a.path + ".1"} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxBytes {
+			t.Errorf("%s is %d bytes, over the %d byte limit", filepath.Base(path), info.Size(), maxBytes)
+		}
+	}
+	if _, err := os.Stat(a.path + ".2"); err == nil {
+		t.Error("rotation kept more than one old generation")
+	}
+
+	entries, err := a.query(time.Time{}, maxAuditLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) >= total {
+		t.Fatalf("read %d entries after rotation, want some but not all %d", len(entries), total)
+	}
+	if entries[0].Action != fmt.Sprintf("a%d", total-1) {
+		t.Errorf("newest entry is %s, want a%d", entries[0].Action, total-1)
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i].Time.Before(entries[i-1].Time) {
+			t.Fatalf("entries are not newest first across generations at %d", i)
+		}
+	}
+}
+
+func TestAuditSkipsTornLine(t *testing.T) {
+	a := newTestAuditLog(t, 0)
+	if err := a.append(auditEntry{Time: time.Now().UTC(), Action: "restart", Outcome: "requested"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2024-05-01T0`)
+	f.Close()
+
+	entries, err := a.query(time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "restart" {
+		t.Errorf("entries = %+v, want just the restart", entries)
+	}
+}
+
+func TestAuditRecordsForwardedClient(t *testing.T) {
+	saved := serverAllowlist
+	serverAllowlist = clientAllowlist{trustProxy: true}
+	t.Cleanup(func() { serverAllowlist = saved })
+
+	a := newTestAuditLog(t, 0)
+	r := httptest.NewRequest(http.MethodPost, "/restart", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "192.168.1.50")
+	a.record(r, "restart", "requested", 0, 0)
+
+	entries, err := a.query(time.Time{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Client != "192.168.1.50" {
+		t.Errorf("entries = %+v, want client 192.168.1.50", entries)
+	}
+}
+
+func TestAuditHandlerRejectsBadQuery(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=1001", "limit=ten", "since=yesterday"} {
+		rec := serve(t, http.MethodGet, "/audit?"+query, "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("/audit?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestAuditNeedsToken(t *testing.T) {
+	handler := requireToken("secret", newMux())
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"audit without token", "/audit", "", http.StatusUnauthorized},
+		{"audit with wrong token", "/audit", "Bearer nope", http.StatusUnauthorized},
+		{"audit with token", "/audit", "Bearer secret", http.StatusOK},
+		{"status stays open", "/status", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditRecordsAttemptsAndBootNextFailures(t *testing.T) {
+	fake := useFakePower(t)
+	fake.boot.options = []bootOption{{ID: "0003", Description: "USB", Active: true}}
+	fake.boot.errs = map[string]error{"Boot0003": errFirmwarePrivilege}
+	saved := audit
+	audit = newTestAuditLog(t, 0)
+	t.Cleanup(func() { audit = saved })
+	captureLog(t)
+
+	fake.fail("restart", syscall.Errno(1726))
+	serve(t, http.MethodPost, "/restart", "")
+	fake.fail("shutdown", syscall.Errno(5))
+	serve(t, http.MethodPost, "/shutdown", "")
+	if rec := serve(t, http.MethodPost, "/api/firmware/bootnext", `{"bootEntry": "0003"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("bootnext: %d %s, want 403", rec.Code, rec.Body)
+	}
+
+	entries, err := audit.query(time.Time{}, maxAuditLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		got = append(got, fmt.Sprintf("%s/%s/%d", entries[i].Action, entries[i].Outcome, entries[i].Attempts))
+	}
+	want := []string{
+		"restart/requested/0", "restart/staged/2",
+		"shutdown/requested/0", "shutdown/failed/1",
+		"restart-boot-entry/failed/0",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// defaultAuditLogPath keeps the service's audit log under ProgramData, where
+// it survives reinstalling the executable. Interactive runs use the
+// executable's directory, like the config file.
+func defaultAuditLogPath() (string, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return "", err
+	}
+	if programData := os.Getenv("ProgramData"); isService && programData != "" {
+		return filepath.Join(programData, serviceName, auditFileName), nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exe), auditFileName), nil
+}
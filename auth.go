@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// tokenEnv names the environment variable the access token is read from,
+// which is the only way to configure it for the Windows service.
+const tokenEnv = "WINDOWSCONTROL_TOKEN"
+
+// privateReads are GET endpoints that need the token anyway, because they
+// reveal who used the server.
+var privateReads = map[string]bool{
+	"/audit": true,
+}
+
+// anonymousKey marks the context of an open read made without the token.
+type anonymousKey struct{}
+
+// anonymousRead reports whether r is an open read made without the token
+// while one is configured. Handlers leave out who used the server from
+// such responses, since the page's EventSource can't send the token.
+func anonymousRead(r *http.Request) bool {
+	anonymous, _ := r.Context().Value(anonymousKey{}).(bool)
+	return anonymous
+}
+
+// requireToken rejects state-changing requests that don't carry token as an
+// Authorization: Bearer credential. Reads stay open so the page can load and
+// ask for the token, except privateReads; open reads without the token are
+// marked for anonymousRead. An empty token disables the check.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := sha256.Sum256([]byte(token))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// Comparing digests keeps the comparison constant-time regardless
+		// of the presented token's length.
+		got := sha256.Sum256([]byte(presented))
+		valid := ok && subtle.ConstantTimeCompare(got[:], want[:]) == 1
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !privateReads[r.URL.Path] {
+			if !valid {
+				r = r.WithContext(context.WithValue(r.Context(), anonymousKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="WindowsControl"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"message": "A valid access token is required. Send it as an Authorization: Bearer header.",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
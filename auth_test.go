@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnonymousReadsAreMarked(t *testing.T) {
+	var anonymous bool
+	handler := requireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anonymous = anonymousRead(r)
+	}))
+	tests := []struct {
+		authorization string
+		want          bool
+	}{
+		{"", true},
+		{"Bearer nope", true},
+		{"Bearer secret", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/events", nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if anonymous != tt.want {
+			t.Errorf("Authorization %q: anonymousRead = %v, want %v", tt.authorization, anonymous, tt.want)
+		}
+	}
+
+	// Without a token configured nothing is hidden.
+	r := httptest.NewRequest(http.MethodGet, "/events", nil)
+	requireToken("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anonymous = anonymousRead(r)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if anonymous {
+		t.Error("a server without a token marked a read anonymous")
+	}
+}
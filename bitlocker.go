@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+)
+
+// encryptableVolume selects the Win32_EncryptableVolume instance of the
+// system drive. Hosts without BitLocker lack the namespace and yield nothing.
+const encryptableVolume = `$v = Get-CimInstance -Namespace root/cimv2/Security/MicrosoftVolumeEncryption -ClassName Win32_EncryptableVolume -Filter "DriveLetter='$env:SystemDrive'" -ErrorAction SilentlyContinue; `
+
+// bitLockerSuspended is set while a restart staged by this server holds
+// BitLocker suspended, so aborting that restart can turn protection back
+// on instead of leaving it off until some later reboot.
+var bitLockerSuspended atomic.Bool
+
+// resumeSuspendedBitLocker re-enables the protectors if this server
+// suspended them for a restart that is no longer going to happen.
+func resumeSuspendedBitLocker() {
+	if !bitLockerSuspended.Swap(false) {
+		return
+	}
+	if err := boot.ResumeBitLocker(); err != nil {
+		log.Printf("resume BitLocker after abort: %v", err)
+		return
+	}
+	log.Printf("BitLocker protection resumed")
+}
+
+// bitLockerCommand guards restarts that change the boot path. With TPM PCR
+// bindings, booting into firmware setup, another boot entry or safe mode can
+// trip the recovery screen, so while protection is on the caller must either suspend
+// it for one reboot (suspendBitLocker) or accept the risk (ignoreBitLocker).
+// Protection is queried and changed through boot.
+// The latter is deliberately not override, which cancels another tool's
+// scheduled shutdown.
+func bitLockerCommand(command powerCommand) powerCommand {
+	return func(req actionRequest) error {
+		protected, err := boot.BitLockerProtected()
+		if err != nil {
+			log.Printf("query BitLocker status: %v", err)
+			return &requestError{status: http.StatusInternalServerError, message: "Could not determine BitLocker status of the system drive; restart aborted."}
+		}
+		if !protected {
+			return command(req)
+		}
+
+		if req.SuspendBitLocker {
+			if err := boot.SuspendBitLocker(); err != nil {
+				log.Printf("suspend BitLocker: %v", err)
+				return &requestError{status: http.StatusInternalServerError, message: "Failed to suspend BitLocker; restart aborted."}
+			}
+			if protected, err := boot.BitLockerProtected(); err != nil || protected {
+				log.Printf("BitLocker still protected after suspend (err=%v)", err)
+				return &requestError{status: http.StatusInternalServerError, message: "BitLocker suspension could not be verified; restart aborted."}
+			}
+			log.Printf("BitLocker suspended for one reboot")
+			if err := command(req); err != nil {
+				if resumeErr := boot.ResumeBitLocker(); resumeErr != nil {
+					log.Printf("resume BitLocker after failed restart: %v", resumeErr)
+				}
+				return err
+			}
+			bitLockerSuspended.Store(true)
+			return nil
+		}
+
+		if !req.IgnoreBitLocker {
+			return &requestError{
+				status:  http.StatusConflict,
+				message: "BitLocker protection is on for the system drive, and this restart may ask for the recovery key. Send suspendBitLocker: true to suspend protection for one reboot, or ignoreBitLocker: true to proceed anyway.",
+				code:    "bitlocker_protected",
+			}
+		}
+		log.Printf("proceeding with a boot path changing restart while BitLocker protection is on (ignoreBitLocker)")
+		return command(req)
+	}
+}
+
+// bitLockerProtected reports whether GetProtectionStatus returns anything
+// other than PROTECTION OFF; an unknown status is treated as protected.
+func bitLockerProtected() (bool, error) {
+	out, err := runPowerShell(encryptableVolume + `if ($v) { ($v | Invoke-CimMethod -MethodName GetProtectionStatus).ProtectionStatus } else { 0 }`)
+	if err != nil {
+		return false, err
+	}
+	return out != "0", nil
+}
+
+func suspendBitLocker() error {
+	return runEncryptableVolumeMethod(`DisableKeyProtectors -Arguments @{DisableCount=[uint32]1}`)
+}
+
+func resumeBitLocker() error {
+	return runEncryptableVolumeMethod(`EnableKeyProtectors`)
+}
+
+func runEncryptableVolumeMethod(method string) error {
+	out, err := runPowerShell(encryptableVolume + `($v | Invoke-CimMethod -MethodName ` + method + `).ReturnValue`)
+	if err != nil {
+		return err
+	}
+	if out != "0" {
+		return fmt.Errorf("Win32_EncryptableVolume returned %s", out)
+	}
+	return nil
+}
+
+func runPowerShell(script string) (string, error) {
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
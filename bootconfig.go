@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// bootConfig changes how the machine boots next: the safe mode flag, the
+// firmware BootNext variable and BitLocker protection. Like power, it is
+// chosen once at startup, so the shutdown.exe stand-in and tests can
+// replace it without touching the machine.
+type bootConfig interface {
+	ArmSafeBoot(network bool) error
+	// ClearSafeBoot removes the safe mode flag and its cleanup task,
+	// succeeding when neither is there.
+	ClearSafeBoot() error
+	BootOptions() ([]bootOption, error)
+	SetBootNext(id uint16) error
+	// ClearBootNext succeeds when BootNext isn't set.
+	ClearBootNext() error
+	// BitLockerProtected reports whether the system drive's protectors
+	// are on; an unknown status counts as on.
+	BitLockerProtected() (bool, error)
+	// SuspendBitLocker turns protection off for one reboot.
+	SuspendBitLocker() error
+	ResumeBitLocker() error
+}
+
+// boot is the boot configuration the handlers change.
+var boot = newBootConfig()
+
+func newBootConfig() bootConfig {
+	if os.Getenv(shutdownBinEnv) != "" {
+		return standInBootConfig{}
+	}
+	return systemBootConfig{}
+}
+
+// systemBootConfig changes the real boot configuration.
+type systemBootConfig struct{}
+
+func (systemBootConfig) ArmSafeBoot(network bool) error     { return armSafeBoot(network) }
+func (systemBootConfig) ClearSafeBoot() error               { return clearSafeBoot() }
+func (systemBootConfig) BootOptions() ([]bootOption, error) { return listBootOptions() }
+func (systemBootConfig) SetBootNext(id uint16) error        { return setBootNext(id) }
+func (systemBootConfig) ClearBootNext() error               { return clearBootNext() }
+func (systemBootConfig) BitLockerProtected() (bool, error)  { return bitLockerProtected() }
+func (systemBootConfig) SuspendBitLocker() error            { return suspendBitLocker() }
+func (systemBootConfig) ResumeBitLocker() error             { return resumeBitLocker() }
+
+// standInBootConfig goes with the shutdown.exe stand-in. It logs the
+// changes it would make and reports BitLocker as off, so a harness can
+// drive every action without changing how the machine boots. Boot options
+// are still read from the firmware, which changes nothing.
+type standInBootConfig struct{}
+
+func (standInBootConfig) ArmSafeBoot(network bool) error {
+	log.Printf("stand-in: would set the safe mode boot flag (network=%v)", network)
+	return nil
+}
+
+func (standInBootConfig) ClearSafeBoot() error {
+	log.Printf("stand-in: would clear the safe mode boot flag")
+	return nil
+}
+
+func (standInBootConfig) BootOptions() ([]bootOption, error) {
+	return listBootOptions()
+}
+
+func (standInBootConfig) SetBootNext(id uint16) error {
+	log.Printf("stand-in: would set BootNext to %s", bootOptionVariable(id))
+	return nil
+}
+
+func (standInBootConfig) ClearBootNext() error {
+	log.Printf("stand-in: would clear BootNext")
+	return nil
+}
+
+func (standInBootConfig) BitLockerProtected() (bool, error) {
+	return false, nil
+}
+
+func (standInBootConfig) SuspendBitLocker() error {
+	log.Printf("stand-in: would suspend BitLocker")
+	return nil
+}
+
+func (standInBootConfig) ResumeBitLocker() error {
+	log.Printf("stand-in: would resume BitLocker")
+	return nil
+}
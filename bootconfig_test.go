@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// fakeBoot records boot configuration changes instead of making them.
+// BitLocker starts protected when protected is set, and suspending or
+// resuming flips it.
+type fakeBoot struct {
+	mu        sync.Mutex
+	calls     []string
+	protected bool
+	options   []bootOption
+	// errs fails every call to a method with its error.
+	errs map[string]error
+}
+
+func (f *fakeBoot) ArmSafeBoot(network bool) error { return f.call("arm-safeboot") }
+func (f *fakeBoot) ClearSafeBoot() error           { return f.call("clear-safeboot") }
+func (f *fakeBoot) SetBootNext(id uint16) error    { return f.call(bootOptionVariable(id)) }
+func (f *fakeBoot) ClearBootNext() error           { return f.call("clear-bootnext") }
+
+func (f *fakeBoot) BootOptions() ([]bootOption, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.options, f.errs["boot-options"]
+}
+
+func (f *fakeBoot) BitLockerProtected() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.protected, f.errs["bitlocker-status"]
+}
+
+func (f *fakeBoot) SuspendBitLocker() error { return f.setProtection("suspend-bitlocker", false) }
+func (f *fakeBoot) ResumeBitLocker() error  { return f.setProtection("resume-bitlocker", true) }
+
+func (f *fakeBoot) setProtection(method string, protected bool) error {
+	if err := f.call(method); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.protected = protected
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeBoot) call(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method)
+	return f.errs[method]
+}
+
+func (f *fakeBoot) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func TestSafeModeRestartGoesThroughBoot(t *testing.T) {
+	fake := useFakePower(t)
+	if rec := serve(t, http.MethodPost, "/restart-safemode", `{"network": true}`); rec.Code != http.StatusOK {
+		t.Fatalf("%d %s", rec.Code, rec.Body)
+	}
+	if calls := fake.boot.called(); !slices.Equal(calls, []string{"arm-safeboot"}) {
+		t.Errorf("boot calls = %v, want [arm-safeboot]", calls)
+	}
+	if calls := fake.called(); !slices.Equal(calls, []string{"restart"}) {
+		t.Errorf("power calls = %v, want [restart]", calls)
+	}
+
+	if rec := serve(t, http.MethodPost, "/abort", ""); rec.Code != http.StatusOK {
+		t.Fatalf("abort: %d %s", rec.Code, rec.Body)
+	}
+	if calls := fake.boot.called(); !slices.Equal(calls, []string{"arm-safeboot", "clear-safeboot"}) {
+		t.Errorf("boot calls = %v, want the flag cleared on abort", calls)
+	}
+}
+
+func TestSafeModeRestartChecksBitLocker(t *testing.T) {
+	fake := useFakePower(t)
+	fake.boot.protected = true
+	rec := serve(t, http.MethodPost, "/restart-safemode", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("%d %s, want 409", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["error"]; got != "bitlocker_protected" {
+		t.Errorf("error = %v, want bitlocker_protected", got)
+	}
+	if calls := fake.boot.called(); len(calls) != 0 {
+		t.Errorf("boot calls = %v, want the flag left alone", calls)
+	}
+	if calls := fake.called(); len(calls) != 0 {
+		t.Errorf("power calls = %v, want none", calls)
+	}
+
+	if rec := serve(t, http.MethodPost, "/restart-safemode", `{"suspendBitLocker": true}`); rec.Code != http.StatusOK {
+		t.Fatalf("with suspendBitLocker: %d %s", rec.Code, rec.Body)
+	}
+	if calls := fake.boot.called(); !slices.Equal(calls, []string{"suspend-bitlocker", "arm-safeboot"}) {
+		t.Errorf("boot calls = %v, want BitLocker suspended before the flag is armed", calls)
+	}
+}
+
+func TestSafeModeFlagClearedWhenRestartFails(t *testing.T) {
+	fake := useFakePower(t)
+	fake.fail("restart", syscall.Errno(5))
+	if rec := serve(t, http.MethodPost, "/restart-safemode", ""); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("%d %s, want 500", rec.Code, rec.Body)
+	}
+	if calls := fake.boot.called(); !slices.Equal(calls, []string{"arm-safeboot", "clear-safeboot"}) {
+		t.Errorf("boot calls = %v, want the flag armed then cleared", calls)
+	}
+}
+
+func TestBitLockerSuspendAndResumeOnAbort(t *testing.T) {
+	fake := useFakePower(t)
+	fake.boot.protected = true
+
+	rec := serve(t, http.MethodPost, "/restart-bios", `{"delaySeconds": 60}`)
+	if rec.Code != http.StatusConflict || decodeBody(t, rec)["error"] != "bitlocker_protected" {
+		t.Fatalf("without a BitLocker choice: %d %s, want 409 bitlocker_protected", rec.Code, rec.Body)
+	}
+	if rec := serve(t, http.MethodPost, "/restart-bios", `{"delaySeconds": 60, "suspendBitLocker": true}`); rec.Code != http.StatusOK {
+		t.Fatalf("with suspendBitLocker: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(t, http.MethodPost, "/abort", ""); rec.Code != http.StatusOK {
+		t.Fatalf("abort: %d %s", rec.Code, rec.Body)
+	}
+	want := []string{"suspend-bitlocker", "clear-safeboot", "resume-bitlocker"}
+	if calls := fake.boot.called(); !slices.Equal(calls, want) {
+		t.Errorf("boot calls = %v, want %v", calls, want)
+	}
+	if calls := fake.called(); !slices.Equal(calls, []string{"restart-firmware", "abort"}) {
+		t.Errorf("power calls = %v", calls)
+	}
+}
+
+func TestBootNextGoesThroughBoot(t *testing.T) {
+	fake := useFakePower(t)
+	fake.boot.options = []bootOption{{ID: "0001", Description: "Windows Boot Manager", Active: true}, {ID: "0003", Description: "USB", Active: true}}
+
+	if rec := serve(t, http.MethodPost, "/api/firmware/bootnext", `{"bootEntry": "0003", "delaySeconds": 60}`); rec.Code != http.StatusOK {
+		t.Fatalf("%d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(t, http.MethodPost, "/abort", ""); rec.Code != http.StatusOK {
+		t.Fatalf("abort: %d %s", rec.Code, rec.Body)
+	}
+	want := []string{"Boot0003", "clear-safeboot", "clear-bootnext"}
+	if calls := fake.boot.called(); !slices.Equal(calls, want) {
+		t.Errorf("boot calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	defaultListenAddr = ":8181"
+	// configFileName is looked up next to the executable when -config isn't
+	// given, which is how the service, started without arguments, finds it.
+	configFileName = "windowscontrol.json"
+)
+
+// config holds the settings that can come from the config file, the
+// environment and flags.
+type config struct {
+	Listen          string `json:"listen"`
+	Token           string `json:"token"`
+	LogFile         string `json:"logFile"`
+	DelayPresets    []int  `json:"delayPresets"`
+	MinDelaySeconds int    `json:"minDelaySeconds"`
+	MaxDelaySeconds int    `json:"maxDelaySeconds"`
+	// WakeTargets are the machines offered for Wake-on-LAN.
+	WakeTargets []wakeTarget `json:"wakeTargets"`
+	// AllowedClients, when set, limits the server to these addresses and
+	// CIDR ranges. RestrictPage extends the limit to the page itself.
+	AllowedClients []string `json:"allowedClients"`
+	RestrictPage   bool     `json:"restrictPage"`
+	TrustProxy     bool     `json:"trustProxy"`
+	// TrustedProxies are the proxy addresses, besides loopback, whose
+	// X-Forwarded-For header TrustProxy honours.
+	TrustedProxies []string `json:"trustedProxies"`
+	// PublicMetrics leaves /metrics open to every client, so a scraper
+	// needn't be added to the allowlist or given credentials.
+	PublicMetrics bool `json:"publicMetrics"`
+	// TLSCert and TLSKey serve HTTPS from an existing key pair;
+	// TLSSelfSigned generates one instead. HTTPRedirect is an optional
+	// second plain-HTTP address that redirects to HTTPS.
+	TLSCert       string `json:"tlsCert"`
+	TLSKey        string `json:"tlsKey"`
+	TLSSelfSigned bool   `json:"tlsSelfSigned"`
+	HTTPRedirect  string `json:"httpRedirect"`
+	// ConfirmActions makes every action wait for a second, confirming
+	// request.
+	ConfirmActions bool `json:"confirmActions"`
+	// AuditLog is the JSON-lines file actions are recorded in, rotated at
+	// AuditLogMaxBytes. Empty means defaultAuditLogPath.
+	AuditLog         string `json:"auditLog"`
+	AuditLogMaxBytes int64  `json:"auditLogMaxBytes"`
+	// StorageWarningPercent and StorageCriticalPercent are the used
+	// percentages of the system volume that storage health warns about.
+	// Zero keeps the default.
+	StorageWarningPercent  float64 `json:"storageWarningPercent"`
+	StorageCriticalPercent float64 `json:"storageCriticalPercent"`
+}
+
+// loadConfig builds the effective settings. Later sources win: defaults, the
+// config file, WINDOWSCONTROL_TOKEN, then the non-zero fields of overrides,
+// which carry the command-line flags. A missing file is only an error when
+// path was given explicitly.
+func loadConfig(path string, overrides config) (config, error) {
+	cfg := config{Listen: defaultListenAddr}
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	if path != "" {
+		if err := readConfigFile(path, &cfg); err != nil {
+			if explicit || !errors.Is(err, fs.ErrNotExist) {
+				return config{}, err
+			}
+		} else {
+			log.Printf("loaded config from %s", path)
+		}
+	}
+
+	if token := os.Getenv(tokenEnv); token != "" {
+		cfg.Token = token
+	}
+	if overrides.Listen != "" {
+		cfg.Listen = overrides.Listen
+	}
+	if overrides.Token != "" {
+		cfg.Token = overrides.Token
+	}
+	if overrides.LogFile != "" {
+		cfg.LogFile = overrides.LogFile
+	}
+	if overrides.TrustProxy {
+		cfg.TrustProxy = true
+	}
+	if overrides.TLSCert != "" {
+		cfg.TLSCert = overrides.TLSCert
+	}
+	if overrides.TLSKey != "" {
+		cfg.TLSKey = overrides.TLSKey
+	}
+	if overrides.TLSSelfSigned {
+		cfg.TLSSelfSigned = true
+	}
+	if overrides.HTTPRedirect != "" {
+		cfg.HTTPRedirect = overrides.HTTPRedirect
+	}
+	if overrides.AuditLog != "" {
+		cfg.AuditLog = overrides.AuditLog
+	}
+
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+func defaultConfigPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(exe), configFileName)
+}
+
+// readConfigFile decodes path over cfg. Unknown keys are rejected so a
+// misspelt setting fails loudly instead of being ignored.
+func readConfigFile(path string, cfg *config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c config) validate() error {
+	if err := validateListenAddr(c.Listen); err != nil {
+		return err
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tlsCert and tlsKey must be set together")
+	}
+	if c.TLSSelfSigned && c.TLSCert != "" {
+		return errors.New("tlsSelfSigned can't be combined with tlsCert")
+	}
+	if c.HTTPRedirect != "" {
+		if !c.tlsEnabled() {
+			return errors.New("httpRedirect needs TLS: set tlsCert and tlsKey or tlsSelfSigned")
+		}
+		if err := validateListenAddr(c.HTTPRedirect); err != nil {
+			return err
+		}
+	}
+	seen := make(map[string]bool)
+	for _, target := range c.WakeTargets {
+		if target.Name == "" {
+			return fmt.Errorf("wake target %q has no name", target.MAC)
+		}
+		if seen[target.Name] {
+			return fmt.Errorf("wake target %q is listed twice", target.Name)
+		}
+		seen[target.Name] = true
+		if _, err := parseWakeMAC(target.MAC); err != nil {
+			return fmt.Errorf("wake target %q: %w", target.Name, err)
+		}
+	}
+	if c.AuditLogMaxBytes < 0 {
+		return errors.New("auditLogMaxBytes must be zero (the default) or positive")
+	}
+	if _, err := parseAllowedClients(c.AllowedClients); err != nil {
+		return err
+	}
+	if _, err := parseAllowedClients(c.TrustedProxies); err != nil {
+		return fmt.Errorf("trustedProxies: %w", err)
+	}
+	if _, err := c.storageThresholds(); err != nil {
+		return err
+	}
+	_, err := c.delaySettings()
+	return err
+}
+
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid listen address %q: port must be between 1 and 65535", addr)
+	}
+	return nil
+}
+
+// openLogFile makes the standard logger also append to path. The file comes
+// first in the writer chain because the service has no usable stderr.
+func openLogFile(path string) (io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open log file: %w", err)
+	}
+	log.SetOutput(io.MultiWriter(f, os.Stderr))
+	return f, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), configFileName)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeConfigFile(t, `{"listen": ":9000", "token": "from-file", "logFile": "file.log"}`)
+	tests := []struct {
+		name       string
+		path       string
+		env        string
+		overrides  config
+		wantListen string
+		wantToken  string
+		wantLog    string
+	}{
+		{"defaults", "", "", config{}, defaultListenAddr, "", ""},
+		{"file over defaults", file, "", config{}, ":9000", "from-file", "file.log"},
+		{"env over file", file, "from-env", config{}, ":9000", "from-env", "file.log"},
+		{"flags over env", file, "from-env", config{Token: "from-flag", Listen: ":9100"}, ":9100", "from-flag", "file.log"},
+		{"unset flags keep the file", file, "", config{LogFile: "flag.log"}, ":9000", "from-file", "flag.log"},
+		{"env without a file", "", "from-env", config{}, defaultListenAddr, "from-env", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tokenEnv, tt.env)
+			cfg, err := loadConfig(tt.path, tt.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Listen != tt.wantListen || cfg.Token != tt.wantToken || cfg.LogFile != tt.wantLog {
+				t.Errorf("listen %q token %q logFile %q, want %q %q %q", cfg.Listen, cfg.Token, cfg.LogFile, tt.wantListen, tt.wantToken, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBooleanFlags(t *testing.T) {
+	t.Setenv(tokenEnv, "")
+	file := writeConfigFile(t, `{"trustProxy": false}`)
+	cfg, err := loadConfig(file, config{TrustProxy: true, TLSSelfSigned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.TrustProxy || !cfg.TLSSelfSigned {
+		t.Errorf("trustProxy %v tlsSelfSigned %v, want both set by the flags", cfg.TrustProxy, cfg.TLSSelfSigned)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  string
+		overrides config
+		want      string
+	}{
+		{"malformed json", `{"listen": `, config{}, "parse"},
+		{"unknown key", `{"lisen": ":9000"}`, config{}, "unknown field"},
+		{"listen without port", `{"listen": "localhost"}`, config{}, "invalid listen address"},
+		{"port out of range", `{"listen": ":70000"}`, config{}, "between 1 and 65535"},
+		{"bad listen flag", `{}`, config{Listen: "nonsense"}, "invalid listen address"},
+		{"cert without key", `{"tlsCert": "c.pem"}`, config{}, "must be set together"},
+		{"self-signed with cert", `{"tlsCert": "c.pem", "tlsKey": "k.pem", "tlsSelfSigned": true}`, config{}, "can't be combined"},
+		{"redirect without tls", `{"httpRedirect": ":80"}`, config{}, "needs TLS"},
+		{"wake target without name", `{"wakeTargets": [{"mac": "aa:bb:cc:dd:ee:ff"}]}`, config{}, "has no name"},
+		{"duplicate wake target", `{"wakeTargets": [{"name": "nas", "mac": "aa:bb:cc:dd:ee:ff"}, {"name": "nas", "mac": "aa:bb:cc:dd:ee:00"}]}`, config{}, "listed twice"},
+		{"bad wake mac", `{"wakeTargets": [{"name": "nas", "mac": "nope"}]}`, config{}, "invalid MAC"},
+		{"negative audit size", `{"auditLogMaxBytes": -1}`, config{}, "auditLogMaxBytes"},
+		{"bad allowed client", `{"allowedClients": ["10.0.0.0/40"]}`, config{}, "10.0.0.0/40"},
+		{"bad trusted proxy", `{"trustedProxies": ["proxy"]}`, config{}, "trustedProxies"},
+		{"min delay above max", `{"minDelaySeconds": 600, "maxDelaySeconds": 60}`, config{}, "greater than"},
+		{"preset out of range", `{"maxDelaySeconds": 60, "delayPresets": [300]}`, config{}, "delay preset 300"},
+		{"storage warning above default critical", `{"storageWarningPercent": 98}`, config{}, "must be below"},
+		{"storage critical over 100", `{"storageCriticalPercent": 101}`, config{}, "between 0 and 100"},
+		{"negative storage warning", `{"storageWarningPercent": -5}`, config{}, "between 0 and 100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tokenEnv, "")
+			_, err := loadConfig(writeConfigFile(t, tt.contents), tt.overrides)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	t.Setenv(tokenEnv, "")
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "absent.json"), config{}); err == nil {
+		t.Error("an explicit config path that doesn't exist was accepted")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// confirmWindow is how long an armed action waits for its confirmation.
+const confirmWindow = 30 * time.Second
+
+// requireConfirmation turns on two-step confirmation for every action,
+// from the confirmActions setting.
+var requireConfirmation bool
+
+// armedAction is what a confirmation token was issued for.
+type armedAction struct {
+	action string
+	// request is the requestFingerprint of the arming request.
+	request string
+	expires time.Time
+}
+
+// confirmationStore holds the outstanding confirmation tokens.
+type confirmationStore struct {
+	mu    sync.Mutex
+	armed map[string]armedAction
+}
+
+var confirmations confirmationStore
+
+// requestFingerprint is a canonical hash of every field of req except the
+// token itself, so a token only confirms exactly what was armed: the same
+// boot entry, the same override, the same delay. An "at" time is kept as
+// sent, because the delay it resolves to shrinks between the two requests.
+func requestFingerprint(req actionRequest) string {
+	req.ConfirmToken = ""
+	if req.At != "" {
+		req.DelaySeconds = 0
+	}
+	canonical, _ := json.Marshal(req)
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// arm issues a one-time token for action as requested by req.
+func (s *confirmationStore) arm(action string, req actionRequest, now time.Time) (string, time.Time, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(raw)
+	expires := now.Add(confirmWindow)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.armed == nil {
+		s.armed = make(map[string]armedAction)
+	}
+	for t, armed := range s.armed {
+		if !now.Before(armed.expires) {
+			delete(s.armed, t)
+		}
+	}
+	s.armed[token] = armedAction{action: action, request: requestFingerprint(req), expires: expires}
+	return token, expires, nil
+}
+
+// confirm reports whether token was issued for action with a request
+// identical to req and hasn't expired. A token is spent by any attempt, matching or
+// not, so it can't be tried against other actions.
+func (s *confirmationStore) confirm(token, action string, req actionRequest, now time.Time) bool {
+	s.mu.Lock()
+	armed, ok := s.armed[token]
+	delete(s.armed, token)
+	s.mu.Unlock()
+	return ok && now.Before(armed.expires) && armed.action == action && armed.request == requestFingerprint(req)
+}
+
+// confirmAction runs the two-step flow when it is enabled. A request without
+// a token is answered with 202 and a token to send back; one with a token
+// proceeds only if the token matches. It returns whether to go ahead.
+func confirmAction(w http.ResponseWriter, action string, req actionRequest) bool {
+	if !requireConfirmation {
+		return true
+	}
+	now := time.Now()
+	if req.ConfirmToken == "" {
+		token, expires, err := confirmations.arm(action, req, now)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{
+				"message": "Failed to issue a confirmation token.",
+				"error":   "exec_failed",
+			})
+			return false
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"message":          "Confirm the " + action + " within " + strconv.Itoa(int(confirmWindow/time.Second)) + " seconds to run it.",
+			"action":           action,
+			"confirmToken":     token,
+			"expiresAt":        expires.UTC().Format(time.RFC3339),
+			"expiresInSeconds": int(confirmWindow / time.Second),
+		})
+		return false
+	}
+	if !confirmations.confirm(req.ConfirmToken, action, req, now) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": "The confirmation token is invalid, expired, already used, or was issued for a different action or request. Send the request again without confirmToken to get a new one.",
+			"error":   "invalid_confirmation",
+		})
+		return false
+	}
+	return true
+}
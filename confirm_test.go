@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfirmationStore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	req := actionRequest{DelaySeconds: 300, BootEntry: "0003"}
+	tests := []struct {
+		name    string
+		action  string
+		confirm actionRequest
+		at      time.Time
+		want    bool
+	}{
+		{"same request", "restart-boot-entry", req, now.Add(10 * time.Second), true},
+		{"expired", "restart-boot-entry", req, now.Add(confirmWindow), false},
+		{"different action", "shutdown", req, now, false},
+		{"different delay", "restart-boot-entry", actionRequest{DelaySeconds: 60, BootEntry: "0003"}, now, false},
+		{"different boot entry", "restart-boot-entry", actionRequest{DelaySeconds: 300, BootEntry: "0005"}, now, false},
+		{"override added", "restart-boot-entry", actionRequest{DelaySeconds: 300, BootEntry: "0003", Override: true}, now, false},
+		{"suspendBitLocker added", "restart-boot-entry", actionRequest{DelaySeconds: 300, BootEntry: "0003", SuspendBitLocker: true}, now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var store confirmationStore
+			token, expires, err := store.arm("restart-boot-entry", req, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !expires.Equal(now.Add(confirmWindow)) {
+				t.Errorf("expires = %v, want %v", expires, now.Add(confirmWindow))
+			}
+			tt.confirm.ConfirmToken = token
+			if got := store.confirm(token, tt.action, tt.confirm, tt.at); got != tt.want {
+				t.Errorf("confirm = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmationTokenIsSingleUse(t *testing.T) {
+	var store confirmationStore
+	now := time.Now()
+	req := actionRequest{DelaySeconds: 30}
+	token, _, err := store.arm("shutdown", req, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.confirm(token, "shutdown", req, now) {
+		t.Fatal("first confirmation failed")
+	}
+	if store.confirm(token, "shutdown", req, now) {
+		t.Fatal("token confirmed twice")
+	}
+}
+
+func TestConfirmationMismatchSpendsToken(t *testing.T) {
+	var store confirmationStore
+	now := time.Now()
+	req := actionRequest{DelaySeconds: 30}
+	token, _, err := store.arm("shutdown", req, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.confirm(token, "restart", req, now) {
+		t.Fatal("token confirmed another action")
+	}
+	if store.confirm(token, "shutdown", req, now) {
+		t.Fatal("token still usable after a mismatched attempt")
+	}
+}
+
+func TestConfirmationKeepsAtAsSent(t *testing.T) {
+	var store confirmationStore
+	now := time.Now()
+	armed := actionRequest{At: "23:30", DelaySeconds: 600}
+	token, _, err := store.arm("shutdown", armed, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same "at" resolves to a slightly shorter delay a moment later.
+	if !store.confirm(token, "shutdown", actionRequest{At: "23:30", DelaySeconds: 595}, now) {
+		t.Fatal("the same at time wasn't confirmed")
+	}
+}
+
+func TestConfirmActionIssuesToken(t *testing.T) {
+	useFakePower(t)
+	requireConfirmation = true
+	t.Cleanup(func() { requireConfirmation = false })
+
+	rec := httptest.NewRecorder()
+	if confirmAction(rec, "shutdown", actionRequest{}) {
+		t.Fatal("an unconfirmed request went ahead")
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+	token, _ := decodeBody(t, rec)["confirmToken"].(string)
+	if token == "" {
+		t.Fatal("no confirmToken issued")
+	}
+	if !confirmAction(httptest.NewRecorder(), "shutdown", actionRequest{ConfirmToken: token}) {
+		t.Fatal("the confirming request was refused")
+	}
+}
+
+func TestConfirmTokenSurvivesBusyGuard(t *testing.T) {
+	fake := useFakePower(t)
+	requireConfirmation = true
+	t.Cleanup(func() { requireConfirmation = false })
+
+	rec := serve(t, http.MethodPost, "/restart", `{"delaySeconds": 60}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("arming: %d %s, want 202", rec.Code, rec.Body)
+	}
+	token := decodeBody(t, rec)["confirmToken"].(string)
+	body := `{"delaySeconds": 60, "confirmToken": "` + token + `"}`
+
+	if _, ok := powerCommands.acquire("shutdown"); !ok {
+		t.Fatal("the command guard is already held")
+	}
+	rec = serve(t, http.MethodPost, "/restart", body)
+	powerCommands.release()
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("while busy: %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	if rec := serve(t, http.MethodPost, "/restart", body); rec.Code != http.StatusOK {
+		t.Fatalf("retry with the same token: %d %s, want 200", rec.Code, rec.Body)
+	}
+	if calls := fake.called(); len(calls) != 1 || calls[0] != "restart" {
+		t.Errorf("calls = %v, want [restart]", calls)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// deferredTimers hold the server-side timers of staged actions that have
+// no delay of their own in Windows, such as sleep or lock, keyed by action.
+// shutdown /a can't cancel these, so /abort stops them here.
+var deferredTimers struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// scheduleDeferred runs fn after delay, replacing a timer already staged for
+// the same action.
+func scheduleDeferred(action string, delay time.Duration, fn func()) {
+	deferredTimers.mu.Lock()
+	defer deferredTimers.mu.Unlock()
+	if timer, ok := deferredTimers.timers[action]; ok {
+		timer.Stop()
+	}
+	if deferredTimers.timers == nil {
+		deferredTimers.timers = make(map[string]*time.Timer)
+	}
+	deferredTimers.timers[action] = time.AfterFunc(delay, fn)
+}
+
+// cancelDeferred stops every staged timer and reports whether any of them
+// was still waiting to run.
+func cancelDeferred() bool {
+	deferredTimers.mu.Lock()
+	defer deferredTimers.mu.Unlock()
+	stopped := false
+	for action, timer := range deferredTimers.timers {
+		if timer.Stop() {
+			stopped = true
+		}
+		delete(deferredTimers.timers, action)
+	}
+	return stopped
+}
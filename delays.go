@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// defaultDelayPresets are offered when the config doesn't list its own.
+var defaultDelayPresets = []int{0, 30, 300, 1800, 7200}
+
+type delayPreset struct {
+	Seconds int    `json:"seconds"`
+	Label   string `json:"label"`
+}
+
+// delaySettings are the delay presets the page offers and the bounds every
+// request's delaySeconds must respect. MaxSeconds 0 means no upper bound.
+type delaySettings struct {
+	Presets    []delayPreset `json:"presets"`
+	MinSeconds int           `json:"minSeconds"`
+	MaxSeconds int           `json:"maxSeconds,omitempty"`
+}
+
+// delays is set from the config once at startup, before any request is
+// served.
+var delays = delaySettings{Presets: presetsFor(defaultDelayPresets)}
+
+// delaySettings validates the configured bounds and presets. Presets listed
+// in the config must fall within the bounds; the built-in ones are filtered
+// instead, so setting only maxDelaySeconds hides the longer defaults.
+func (c config) delaySettings() (delaySettings, error) {
+	settings := delaySettings{MinSeconds: c.MinDelaySeconds, MaxSeconds: c.MaxDelaySeconds}
+	if settings.MinSeconds < 0 || settings.MaxSeconds < 0 {
+		return delaySettings{}, fmt.Errorf("minDelaySeconds and maxDelaySeconds must be zero or positive")
+	}
+	if settings.MaxSeconds > 0 && settings.MinSeconds > settings.MaxSeconds {
+		return delaySettings{}, fmt.Errorf("minDelaySeconds (%d) is greater than maxDelaySeconds (%d)", settings.MinSeconds, settings.MaxSeconds)
+	}
+
+	presets := c.DelayPresets
+	if presets == nil {
+		presets = slices.DeleteFunc(slices.Clone(defaultDelayPresets), func(seconds int) bool {
+			return !settings.allows(seconds)
+		})
+	}
+	for _, seconds := range presets {
+		if !settings.allows(seconds) {
+			return delaySettings{}, fmt.Errorf("delay preset %d is outside %s", seconds, settings.describeBounds())
+		}
+	}
+	settings.Presets = presetsFor(presets)
+	return settings, nil
+}
+
+func (s delaySettings) allows(seconds int) bool {
+	return seconds >= s.MinSeconds && (s.MaxSeconds == 0 || seconds <= s.MaxSeconds)
+}
+
+func (s delaySettings) describeBounds() string {
+	if s.MaxSeconds == 0 {
+		return fmt.Sprintf("the allowed range (at least %d seconds)", s.MinSeconds)
+	}
+	return fmt.Sprintf("the allowed range (%d to %d seconds)", s.MinSeconds, s.MaxSeconds)
+}
+
+func presetsFor(seconds []int) []delayPreset {
+	presets := make([]delayPreset, 0, len(seconds))
+	for _, s := range seconds {
+		presets = append(presets, delayPreset{Seconds: s, Label: delayLabel(s)})
+	}
+	return presets
+}
+
+// delayLabel names a preset the way the page shows it, e.g. "5 minutes".
+func delayLabel(seconds int) string {
+	switch {
+	case seconds == 0:
+		return "Immediately"
+	case seconds%3600 == 0:
+		return pluralize(seconds/3600, "hour")
+	case seconds%60 == 0:
+		return pluralize(seconds/60, "minute")
+	default:
+		return pluralize(seconds, "second")
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventBuffer is how many events a subscriber may fall behind before it
+// starts missing them.
+const eventBuffer = 16
+
+// sseKeepAlive is how often an idle stream gets a comment line, so proxies
+// and browsers don't time it out.
+const sseKeepAlive = 30 * time.Second
+
+// actionEvent is what GET /events streams. Type is "status" for the snapshot
+// sent on connect, then "staged", "fired" or "cancelled".
+type actionEvent struct {
+	Type             string `json:"type"`
+	Action           string `json:"action,omitempty"`
+	FiresAt          string `json:"firesAt,omitempty"`
+	RemainingSeconds int    `json:"remainingSeconds,omitempty"`
+	// ExternalRebootPending is set on status events, like on GET /status.
+	ExternalRebootPending bool `json:"externalRebootPending,omitempty"`
+	// Client is the address of whoever staged or cancelled the action. It
+	// is left out of streams opened without the access token.
+	Client string `json:"client,omitempty"`
+}
+
+// eventBroadcaster fans events out to the open /events streams.
+type eventBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan actionEvent]struct{}
+	closed      bool
+}
+
+var events eventBroadcaster
+
+// subscribe registers a stream. The channel is closed by unsubscribe or
+// when the broadcaster shuts down.
+func (b *eventBroadcaster) subscribe() chan actionEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan actionEvent, eventBuffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan actionEvent]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroadcaster) unsubscribe(ch chan actionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish never blocks: a subscriber whose buffer is full misses the event
+// rather than stalling the handler that published it.
+func (b *eventBroadcaster) publish(event actionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close ends every stream so http.Server.Shutdown isn't held up by them.
+func (b *eventBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+	b.closed = true
+}
+
+// requestClient is the address a request came from, without the port. Behind
+// a trusted proxy it is the forwarded client, as the allowlist sees it.
+func requestClient(r *http.Request) string {
+	if addr, err := serverAllowlist.clientAddr(r); err == nil {
+		return addr.String()
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func statusEvent() actionEvent {
+	external := externalReboot.Load()
+	pending, ok := pendingActions.current()
+	if !ok {
+		return actionEvent{Type: "status", ExternalRebootPending: external}
+	}
+	return actionEvent{
+		Type:                  "status",
+		Action:                pending.action,
+		FiresAt:               pending.firesAt.UTC().Format(time.RFC3339),
+		RemainingSeconds:      secondsUntil(pending.firesAt),
+		ExternalRebootPending: external,
+	}
+}
+
+// eventsHandler streams actionEvents as server-sent events, starting with
+// the current status.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+	anonymous := anonymousRead(r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	writeEvent(w, statusEvent())
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if anonymous {
+				event.Client = ""
+			}
+			writeEvent(w, event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event actionEvent) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
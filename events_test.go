@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent returns the next data line of an SSE stream as an actionEvent.
+func readEvent(lines *bufio.Scanner) (actionEvent, error) {
+	for lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event actionEvent
+		err := json.Unmarshal([]byte(data), &event)
+		return event, err
+	}
+	return actionEvent{}, fmt.Errorf("stream ended: %v", lines.Err())
+}
+
+func TestEventsHideClientWithoutToken(t *testing.T) {
+	useFakePower(t)
+	server := httptest.NewServer(requireToken("secret", newMux()))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantClient    string
+	}{
+		{"without the token", "", ""},
+		{"with the token", "Bearer secret", "192.0.2.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			lines := bufio.NewScanner(resp.Body)
+			if event, err := readEvent(lines); err != nil || event.Type != "status" {
+				t.Fatalf("first event = %+v, %v, want status", event, err)
+			}
+
+			events.publish(actionEvent{Type: "staged", Action: "restart", Client: "192.0.2.7"})
+			done := make(chan actionEvent, 1)
+			go func() {
+				event, err := readEvent(lines)
+				if err != nil {
+					event.Type = err.Error()
+				}
+				done <- event
+			}()
+			select {
+			case event := <-done:
+				if event.Type != "staged" {
+					t.Fatalf("event = %+v, want staged", event)
+				}
+				if event.Client != tt.wantClient {
+					t.Errorf("client = %q, want %q", event.Client, tt.wantClient)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no staged event arrived")
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// loadOptionActive is LOAD_OPTION_ACTIVE from the EFI_LOAD_OPTION attributes.
+const loadOptionActive = 0x1
+
+var (
+	errFirmwareUnsupported = errors.New("this machine did not boot in UEFI mode, so boot options are unavailable")
+	errFirmwarePrivilege   = errors.New("SeSystemEnvironmentPrivilege is not held")
+)
+
+type bootOption struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Active      bool   `json:"active"`
+}
+
+func bootOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if runtime.GOOS != "windows" {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"message": "UEFI boot options are available only on Windows hosts.",
+		})
+		return
+	}
+
+	options, err := boot.BootOptions()
+	if err != nil {
+		writeFirmwareError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"bootOptions": options,
+	})
+}
+
+// bootNextRestart runs restart-boot-entry. It looks the entry up before
+// asking for confirmation, so a token is never issued for an entry that
+// doesn't exist.
+func bootNextRestart(w http.ResponseWriter, r *http.Request, req actionRequest) {
+	const action = "restart-boot-entry"
+	if !checkPolicy(w, action) {
+		return
+	}
+
+	options, err := boot.BootOptions()
+	if err != nil {
+		writeFirmwareError(w, err)
+		return
+	}
+	option, id, ok := findBootOption(options, req.BootEntry)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": fmt.Sprintf("Unknown boot entry %q. GET /api/firmware/bootoptions lists the valid IDs.", req.BootEntry),
+			"error":   "unknown_boot_entry",
+		})
+		return
+	}
+
+	if !claimPowerCommand(w, action) {
+		return
+	}
+	defer powerCommands.release()
+	if !confirmAction(w, action, req) {
+		return
+	}
+
+	if err := boot.SetBootNext(id); err != nil {
+		audit.record(r, action, "failed", req.DelaySeconds, 0)
+		writeFirmwareError(w, err)
+		return
+	}
+	message := fmt.Sprintf("Restart command staged. The machine will boot %q once.", option.Description)
+	if !executePowerAction(w, r, action, req, bitLockerCommand(power.Restart), message) {
+		// Don't leave a one-time boot entry armed for some later reboot.
+		if err := boot.ClearBootNext(); err != nil {
+			log.Printf("clear BootNext after failed restart: %v", err)
+		}
+	}
+}
+
+func writeFirmwareError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errFirmwarePrivilege):
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"message": "Accessing UEFI variables requires SeSystemEnvironmentPrivilege. Run WindowsControl from an elevated prompt or as the Windows service.",
+		})
+	case errors.Is(err, errFirmwareUnsupported):
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"message": "This machine did not boot in UEFI mode, so boot options are unavailable.",
+		})
+	default:
+		log.Printf("firmware variable access failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to access UEFI boot variables.",
+		})
+	}
+}
+
+// findBootOption looks up a hex option number such as "0003" among the
+// enumerated entries, so only existing Boot#### variables can be targeted.
+func findBootOption(options []bootOption, id string) (bootOption, uint16, bool) {
+	want, err := strconv.ParseUint(strings.TrimSpace(id), 16, 16)
+	if err != nil {
+		return bootOption{}, 0, false
+	}
+	for _, option := range options {
+		if option.ID == fmt.Sprintf("%04X", want) {
+			return option, uint16(want), true
+		}
+	}
+	return bootOption{}, 0, false
+}
+
+func bootOptionVariable(id uint16) string {
+	return fmt.Sprintf("Boot%04X", id)
+}
+
+// parseBootOrder decodes the BootOrder variable, an array of UINT16 option
+// numbers.
+func parseBootOrder(data []byte) ([]uint16, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("BootOrder has odd length %d", len(data))
+	}
+	ids := make([]uint16, 0, len(data)/2)
+	for i := 0; i < len(data); i += 2 {
+		ids = append(ids, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return ids, nil
+}
+
+// parseLoadOption extracts the attributes and description from an
+// EFI_LOAD_OPTION: UINT32 Attributes, UINT16 FilePathListLength, then a
+// NUL-terminated UCS-2 description followed by the device path.
+func parseLoadOption(id uint16, data []byte) (bootOption, error) {
+	if len(data) < 6 {
+		return bootOption{}, fmt.Errorf("load option too short (%d bytes)", len(data))
+	}
+	attributes := binary.LittleEndian.Uint32(data[0:4])
+	var chars []uint16
+	for i := 6; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+	return bootOption{
+		ID:          fmt.Sprintf("%04X", id),
+		Description: string(utf16.Decode(chars)),
+		Active:      attributes&loadOptionActive != 0,
+	}, nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+func listBootOptions() ([]bootOption, error) {
+	return nil, errFirmwareUnsupported
+}
+
+func setBootNext(id uint16) error {
+	return errFirmwareUnsupported
+}
+
+func clearBootNext() error {
+	return nil
+}
+
+func bootedFromUEFI() bool {
+	return false
+}
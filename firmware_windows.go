@@ -0,0 +1,146 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// efiGlobalVariable is EFI_GLOBAL_VARIABLE, the vendor GUID of BootOrder,
+// BootNext and the Boot#### load options.
+const efiGlobalVariable = "{8BE4DF61-93CA-11D2-AA0D-00E098032B8C}"
+
+var (
+	modkernel32                         = windows.NewLazySystemDLL("kernel32.dll")
+	procGetFirmwareEnvironmentVariableW = modkernel32.NewProc("GetFirmwareEnvironmentVariableW")
+	procSetFirmwareEnvironmentVariableW = modkernel32.NewProc("SetFirmwareEnvironmentVariableW")
+	procGetFirmwareType                 = modkernel32.NewProc("GetFirmwareType")
+)
+
+// firmwareTypeUefi is FirmwareTypeUefi from the FIRMWARE_TYPE enumeration.
+const firmwareTypeUefi = 2
+
+// bootedFromUEFI reports whether Windows booted through UEFI. Unlike reading
+// a firmware variable it needs no privilege.
+func bootedFromUEFI() bool {
+	var firmwareType uint32
+	if ret, _, _ := procGetFirmwareType.Call(uintptr(unsafe.Pointer(&firmwareType))); ret == 0 {
+		return false
+	}
+	return firmwareType == firmwareTypeUefi
+}
+
+func listBootOptions() ([]bootOption, error) {
+	if err := enablePrivilege("SeSystemEnvironmentPrivilege"); err != nil {
+		return nil, fmt.Errorf("enable SeSystemEnvironmentPrivilege: %w", err)
+	}
+
+	order, err := readFirmwareVariable("BootOrder")
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseBootOrder(order)
+	if err != nil {
+		return nil, err
+	}
+
+	options := make([]bootOption, 0, len(ids))
+	for _, id := range ids {
+		data, err := readFirmwareVariable(bootOptionVariable(id))
+		if err != nil {
+			if errors.Is(err, windows.ERROR_ENVVAR_NOT_FOUND) {
+				continue
+			}
+			return nil, err
+		}
+		option, err := parseLoadOption(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bootOptionVariable(id), err)
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+func setBootNext(id uint16) error {
+	if err := enablePrivilege("SeSystemEnvironmentPrivilege"); err != nil {
+		return fmt.Errorf("enable SeSystemEnvironmentPrivilege: %w", err)
+	}
+	value := []byte{byte(id), byte(id >> 8)}
+	return writeFirmwareVariable("BootNext", value)
+}
+
+func clearBootNext() error {
+	err := writeFirmwareVariable("BootNext", nil)
+	if errors.Is(err, windows.ERROR_ENVVAR_NOT_FOUND) {
+		return nil
+	}
+	return err
+}
+
+func readFirmwareVariable(name string) ([]byte, error) {
+	namePtr, guidPtr, err := firmwareVariablePointers(name)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	n, _, callErr := procGetFirmwareEnvironmentVariableW.Call(
+		uintptr(unsafe.Pointer(namePtr)),
+		uintptr(unsafe.Pointer(guidPtr)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)))
+	if n == 0 {
+		return nil, mapFirmwareError(callErr)
+	}
+	return buf[:n], nil
+}
+
+// writeFirmwareVariable stores value with the default non-volatile,
+// boot-service and runtime attributes. An empty value deletes the variable.
+func writeFirmwareVariable(name string, value []byte) error {
+	namePtr, guidPtr, err := firmwareVariablePointers(name)
+	if err != nil {
+		return err
+	}
+	var data uintptr
+	if len(value) > 0 {
+		data = uintptr(unsafe.Pointer(&value[0]))
+	}
+	ok, _, callErr := procSetFirmwareEnvironmentVariableW.Call(
+		uintptr(unsafe.Pointer(namePtr)),
+		uintptr(unsafe.Pointer(guidPtr)),
+		data,
+		uintptr(len(value)))
+	if ok == 0 {
+		return mapFirmwareError(callErr)
+	}
+	return nil
+}
+
+func firmwareVariablePointers(name string) (*uint16, *uint16, error) {
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	guidPtr, err := windows.UTF16PtrFromString(efiGlobalVariable)
+	if err != nil {
+		return nil, nil, err
+	}
+	return namePtr, guidPtr, nil
+}
+
+// mapFirmwareError translates the errors the firmware variable APIs use to
+// signal a legacy BIOS boot or a missing privilege.
+func mapFirmwareError(err error) error {
+	switch {
+	case errors.Is(err, windows.ERROR_INVALID_FUNCTION):
+		return errFirmwareUnsupported
+	case errors.Is(err, windows.ERROR_PRIVILEGE_NOT_HELD):
+		return errFirmwarePrivilege
+	}
+	return err
+}
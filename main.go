@@ -2,24 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-const listenAddr = ":8181"
-
 var pageTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -102,97 +104,377 @@ var pageTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
         }
         button:hover:enabled { background: #e74c3c; }
         button:disabled { opacity: 0.5; cursor: not-allowed; }
+        button.locked::before { content: "\1F512  "; }
+        #abort { background: #2c3e50; }
+        #abort:hover:enabled { background: #34495e; }
         #status { margin-top: 1rem; font-weight: bold; }
+		.sysinfo {
+			margin-bottom: 1rem;
+			padding: 0.75rem;
+			border-radius: 8px;
+			background: #f4f6f7;
+			color: #2c3e50;
+			font-size: 0.95rem;
+			text-align: left;
+		}
+		.sysinfo .warning {
+			color: #c0392b;
+			font-weight: bold;
+		}
+        #confirm-action { margin-top: 0.75rem; background: #27ae60; }
+        #confirm-action:hover:enabled { background: #2ecc71; }
+        #confirm-action[hidden] { display: none; }
+		.banner {
+			background: #fdecea;
+			color: #c0392b;
+			border: 1px solid #f5b7b1;
+			border-radius: 8px;
+			padding: 0.75rem 1rem;
+			margin-bottom: 1rem;
+			font-weight: bold;
+		}
+		.restore-apps {
+			font-size: 0.9rem;
+			color: #2c3e50;
+			text-align: left;
+		}
+		.wake-targets {
+			display: flex;
+			flex-wrap: wrap;
+			gap: 0.5rem;
+			margin-top: 1.5rem;
+			align-items: center;
+		}
+		.wake-targets label {
+			width: 100%;
+			text-align: left;
+			font-weight: bold;
+			color: #2c3e50;
+		}
+		.wake-targets button {
+			background: #27ae60;
+			padding: 0.6rem 1.2rem;
+			font-size: 1rem;
+		}
+		.wake-targets button:hover:enabled {
+			background: #2ecc71;
+		}
+		.boot-next {
+			display: flex;
+			gap: 0.5rem;
+		}
+		.boot-next[hidden] {
+			display: none;
+		}
+		.advanced summary {
+			cursor: pointer;
+			font-weight: bold;
+			color: #2c3e50;
+			text-align: left;
+		}
+		.advanced-actions {
+			display: flex;
+			flex-direction: column;
+			gap: 0.75rem;
+			margin-top: 0.75rem;
+		}
+		.activity {
+			margin-top: 1.5rem;
+			text-align: left;
+			color: #2c3e50;
+			font-size: 0.9rem;
+		}
+		.activity summary {
+			cursor: pointer;
+			font-weight: bold;
+		}
+		.activity ul {
+			padding-left: 1.25rem;
+		}
+		.boot-next select {
+			flex: 1;
+			padding: 0.5rem;
+			border-radius: 8px;
+			border: 1px solid #d5d8dc;
+			font-size: 1rem;
+		}
     </style>
 </head>
 <body>
     <div class="card">
         <h1>Windows Power Control</h1>
+		<div class="banner" id="storage-warning" hidden></div>
 		<p>Trigger these power actions immediately or schedule them shortly in the future.</p>
 		<div class="delay-control">
 			<label>Delay before running command</label>
 			<div class="delay-presets" id="delay-presets">
-				<button type="button" class="selected" data-delay-seconds="0">Immediately</button>
-				<button type="button" data-delay-seconds="30">30 seconds</button>
-				<button type="button" data-delay-seconds="300">5 minutes</button>
-				<button type="button" data-delay-seconds="1800">30 minutes</button>
-				<button type="button" data-delay-seconds="7200">2 hours</button>
+				{{range $i, $preset := .Delays.Presets}}<button type="button"{{if eq $i 0}} class="selected"{{end}} data-delay-seconds="{{$preset.Seconds}}">{{$preset.Label}}</button>
+				{{end}}
 			</div>
 			<div class="custom-delay">
 				<label for="delay-minutes">Or enter minutes</label>
-				<input type="number" id="delay-minutes" min="0" placeholder="e.g. 10" />
+				<input type="number" id="delay-minutes" step="any" placeholder="e.g. 10" />
+			</div>
+			<div class="custom-delay">
+				<label for="delay-at">Or run at (machine's local time)</label>
+				<input type="time" id="delay-at" />
+			</div>
+			<div class="custom-delay">
+				<label for="shutdown-comment">Reason shown to signed-in users (optional)</label>
+				<input type="text" id="shutdown-comment" maxlength="512" placeholder="e.g. Installing new drivers" />
 			</div>
 		</div>
+        <div class="sysinfo" id="sysinfo" hidden></div>
         <div class="buttons">
-            <button id="shutdown">Shut Down</button>
-            <button id="restart">Restart</button>
-            <button id="restart-bios">Restart to BIOS</button>
+            <button id="shutdown"{{with index .Locked "shutdown"}} class="locked" title="{{.}}" disabled{{end}}>Shut Down</button>
+            <button id="restart"{{with index .Locked "restart"}} class="locked" title="{{.}}" disabled{{end}}>Restart</button>
+            <label class="restore-apps"><input type="checkbox" id="restore-apps" /> Relaunch registered apps after restarting</label>
+            {{if .UpdatesReady}}<button id="restart-update"{{with index .Locked "restart-update"}} class="locked" title="{{.}}" disabled{{end}}>Update and Restart</button>{{end}}
+            <button id="restart-bios"{{with index .Locked "restart-bios"}} class="locked" title="{{.}}" disabled{{end}}>Restart to BIOS</button>
+            <div class="boot-next" id="boot-next" hidden>
+                <select id="boot-entry" aria-label="UEFI boot entry"></select>
+                <button id="restart-boot-entry"{{with index .Locked "restart-boot-entry"}} class="locked" title="{{.}}" disabled{{end}}>Boot Once</button>
+            </div>
+            <details class="advanced">
+                <summary>Advanced</summary>
+                <div class="advanced-actions">
+                    <button id="restart-recovery"{{with index .Locked "restart-recovery"}} class="locked" title="{{.}}" disabled{{end}}>Restart to Recovery</button>
+                    <button id="restart-safemode"{{with index .Locked "restart-safemode"}} class="locked" title="{{.}}" disabled{{end}}>Restart in Safe Mode</button>
+                    <label class="restore-apps"><input type="checkbox" id="safemode-network" /> Safe mode with networking</label>
+                </div>
+            </details>
+            <button id="sleep"{{with index .Locked "sleep"}} class="locked" title="{{.}}" disabled{{end}}>Sleep</button>
+            <button id="hibernate"{{with index .Locked "hibernate"}} class="locked" title="{{.}}" disabled{{end}}>Hibernate</button>
+            <button id="lock">Lock</button>
+            <button id="logoff">Sign Out</button>
+            <button id="abort"{{if not .PendingAction}} disabled{{end}}>Cancel pending action</button>
         </div>
+        {{if .WakeTargets}}<div class="wake-targets">
+            <label>Wake other machines</label>
+            {{range .WakeTargets}}<button type="button" data-wake-target="{{.Name}}" title="{{.MAC}}">Wake {{.Name}}</button>
+            {{end}}
+        </div>{{end}}
         <div id="status"></div>
+        <button id="confirm-action" hidden>Confirm</button>
+        <details class="activity" id="activity">
+            <summary>Recent activity</summary>
+            <ul id="activity-list"></ul>
+        </details>
     </div>
     <script>
 	const status = document.getElementById('status');
 	const delayPresets = Array.from(document.querySelectorAll('#delay-presets button'));
 	const delayMinutesInput = document.getElementById('delay-minutes');
-	let selectedDelaySeconds = 0;
+	const delayAtInput = document.getElementById('delay-at');
+	const commentInput = document.getElementById('shutdown-comment');
+	const bootEntrySelect = document.getElementById('boot-entry');
+	const restoreAppsCheckbox = document.getElementById('restore-apps');
+	const safeModeNetworkCheckbox = document.getElementById('safemode-network');
+	const abortButton = document.getElementById('abort');
+	const minDelaySeconds = {{.Delays.MinSeconds}};
+	const maxDelaySeconds = {{.Delays.MaxSeconds}};
+	const defaultDelaySeconds = delayPresets.length > 0 ? Number.parseInt(delayPresets[0].dataset.delaySeconds, 10) : minDelaySeconds;
+	let selectedDelaySeconds = defaultDelaySeconds;
+	let selectedAt = '';
+	let countdownTimer = null;
+	let pendingAction = {{.PendingAction}};
+	let pendingFiresAt = '';
+	// ownFiresAt marks the last action this page staged, whose event is
+	// already reflected by the response.
+	let ownFiresAt = '';
+	let busy = false;
+	// confirmActions: the server arms each action and waits for an in-page
+	// confirmation, which replaces the browser dialog.
+	const serverConfirms = {{.ConfirmActions}};
+	const confirmButton = document.getElementById('confirm-action');
 
 	delayPresets.forEach(btn => {
 		btn.addEventListener('click', () => {
 			selectedDelaySeconds = Number.parseInt(btn.dataset.delaySeconds, 10) || 0;
 			delayPresets.forEach(b => b.classList.toggle('selected', b === btn));
 			delayMinutesInput.value = '';
+			delayMinutesInput.setCustomValidity('');
+			delayAtInput.value = '';
+			selectedAt = '';
 		});
 	});
 
+	delayMinutesInput.min = minDelaySeconds / 60;
+	if (maxDelaySeconds > 0) {
+		delayMinutesInput.max = maxDelaySeconds / 60;
+	}
+
+	// The server enforces the same bounds; checking here just saves a round
+	// trip and explains the limit next to the input.
 	delayMinutesInput.addEventListener('input', () => {
 		const minutes = Number.parseFloat(delayMinutesInput.value);
+		delayMinutesInput.setCustomValidity('');
 		if (Number.isFinite(minutes) && minutes > 0) {
 			selectedDelaySeconds = Math.round(minutes * 60);
+			if (selectedDelaySeconds < minDelaySeconds || (maxDelaySeconds > 0 && selectedDelaySeconds > maxDelaySeconds)) {
+				delayMinutesInput.setCustomValidity(maxDelaySeconds > 0
+					? 'Enter between ' + formatRemaining(minDelaySeconds) + ' and ' + formatRemaining(maxDelaySeconds) + '.'
+					: 'Enter at least ' + formatRemaining(minDelaySeconds) + '.');
+				delayMinutesInput.reportValidity();
+			}
+			delayPresets.forEach(btn => btn.classList.remove('selected'));
+			delayAtInput.value = '';
+			selectedAt = '';
 		} else {
-			selectedDelaySeconds = 0;
+			selectedDelaySeconds = defaultDelaySeconds;
+			delayPresets.forEach((btn, i) => btn.classList.toggle('selected', i === 0));
+		}
+	});
+
+	// A picked time is sent as "at" instead of delaySeconds; the server
+	// resolves it to the next occurrence in the machine's time zone.
+	delayAtInput.addEventListener('input', () => {
+		selectedAt = delayAtInput.value;
+		if (selectedAt) {
+			delayMinutesInput.value = '';
+			delayMinutesInput.setCustomValidity('');
+			delayPresets.forEach(btn => btn.classList.remove('selected'));
+		} else {
+			selectedDelaySeconds = defaultDelaySeconds;
+			delayPresets.forEach((btn, i) => btn.classList.toggle('selected', i === 0));
 		}
-		delayPresets.forEach(btn => btn.classList.remove('selected'));
 	});
 
 	const actions = [
 		{
 			id: 'shutdown',
 			endpoint: '/shutdown',
+			comment: true,
 			confirm: 'This will power off the machine using the selected delay. Continue?'
 		},
 		{
 			id: 'restart',
 			endpoint: '/restart',
-			confirm: 'This will restart the machine using the selected delay. Continue?'
+			comment: true,
+			confirm: () => restoreAppsCheckbox.checked
+				? 'This will restart the machine using the selected delay and relaunch applications registered for restart. Other apps will not come back. Continue?'
+				: 'This will restart the machine using the selected delay. Continue?',
+			body: () => ({ restoreApps: restoreAppsCheckbox.checked })
+		},
+		{
+			id: 'restart-update',
+			endpoint: '/restart-update',
+			comment: true,
+			confirm: 'This will install the downloaded Windows updates and restart the machine using the selected delay. Continue?'
 		},
 		{
 			id: 'restart-bios',
 			endpoint: '/restart-bios',
+			comment: true,
 			confirm: 'This will restart straight into firmware/BIOS (UEFI systems only) using the selected delay. Continue?'
+		},
+		{
+			id: 'restart-recovery',
+			endpoint: '/restart-recovery',
+			comment: true,
+			confirm: 'This will restart into the Windows Recovery Environment using the selected delay. Leaving it needs someone at the console. Continue?'
+		},
+		{
+			id: 'restart-safemode',
+			endpoint: '/restart-safemode',
+			comment: true,
+			confirm: () => 'This will restart into safe mode' + (safeModeNetworkCheckbox.checked ? ' with networking' : '') +
+				' using the selected delay. The boot after that is back to normal. Continue?',
+			body: () => ({ network: safeModeNetworkCheckbox.checked })
+		},
+		{
+			id: 'restart-boot-entry',
+			endpoint: '/api/firmware/bootnext',
+			comment: true,
+			confirm: 'This will restart once into the selected UEFI boot entry using the selected delay. Continue?',
+			body: () => ({ bootEntry: bootEntrySelect.value })
+		},
+		{
+			id: 'sleep',
+			endpoint: '/sleep',
+			confirm: 'This will put the machine to sleep using the selected delay. Continue?'
+		},
+		{
+			id: 'hibernate',
+			endpoint: '/hibernate',
+			confirm: 'This will hibernate the machine using the selected delay. Continue?'
+		},
+		{
+			id: 'lock',
+			endpoint: '/lock',
+			confirm: 'This will lock the console session using the selected delay. Continue?'
+		},
+		{
+			id: 'logoff',
+			endpoint: '/logoff',
+			confirm: 'This will sign out the user at the console using the selected delay. Unsaved work in their apps will be lost. Continue?'
 		}
-	];
+	].filter(action => document.getElementById(action.id) !== null);
+
+	loadBootOptions();
+	checkStorageHealth();
+	loadSystemInfo();
+	loadActivity();
+	document.getElementById('activity').addEventListener('toggle', loadActivity);
+	if (pendingAction) {
+		startCountdown('Pending action: ' + pendingAction + '.', {{.PendingSeconds}});
+	}
+	subscribeToEvents();
 
         actions.forEach(action => {
             const btn = document.getElementById(action.id);
             btn.addEventListener('click', async () => {
-                if (!confirm(action.confirm)) {
+                if (!delayMinutesInput.checkValidity()) {
+                    status.textContent = delayMinutesInput.validationMessage;
+                    status.style.color = '#c0392b';
                     return;
                 }
-			const delaySeconds = selectedDelaySeconds;
+                const warning = await loadSystemInfo();
+                const prompt = warning + (typeof action.confirm === 'function' ? action.confirm() : action.confirm);
+                if (!serverConfirms && !confirm(prompt)) {
+                    return;
+                }
+			const timing = selectedAt ? { at: selectedAt } : { delaySeconds: selectedDelaySeconds };
                 status.textContent = 'Sending command...';
                 status.style.color = '#2c3e50';
                 toggleButtons(true);
                 try {
-                    const response = await fetch(action.endpoint, {
-                        method: 'POST',
-                        headers: {
-                            'Content-Type': 'application/json'
-                        },
-                        body: JSON.stringify({ delaySeconds })
-                    });
-                    const data = await response.json();
-                    status.textContent = data.message;
+                    const comment = action.comment ? commentInput.value.trim() : '';
+                    const payload = { ...timing, ...(comment ? { comment } : {}), ...(action.body ? action.body() : {}) };
+                    let response = await sendConfirmed(action.endpoint, payload, prompt);
+                    if (!response) {
+                        status.textContent = 'Not confirmed, so nothing was staged.';
+                        return;
+                    }
+                    let data = await response.json();
+                    if (response.status === 409 && data.error === 'bitlocker_protected') {
+                        let retry = null;
+                        if (confirm(data.message + '\n\nSuspend BitLocker for one reboot and continue?')) {
+                            retry = { suspendBitLocker: true };
+                        } else if (confirm('Continue without suspending BitLocker? The machine may ask for the recovery key at boot.')) {
+                            retry = { ignoreBitLocker: true };
+                        }
+                        if (retry) {
+                            response = await sendConfirmed(action.endpoint, { ...payload, ...retry }, prompt);
+                            if (!response) {
+                                status.textContent = 'Not confirmed, so nothing was staged.';
+                                return;
+                            }
+                            data = await response.json();
+                        }
+                    }
                     status.style.color = response.ok ? '#2c3e50' : '#c0392b';
+                    if (response.ok) {
+                        ownFiresAt = data.scheduledAt;
+                    }
+                    if (response.ok && data.secondsRemaining > 0) {
+                        pendingAction = data.action;
+                        pendingFiresAt = data.scheduledAt;
+                        startCountdown(data.message, data.secondsRemaining);
+                    } else {
+                        stopCountdown();
+                        status.textContent = data.message;
+                    }
                 } catch (err) {
                     status.textContent = 'Failed to contact server.';
                     status.style.color = '#c0392b';
@@ -202,19 +484,406 @@ var pageTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             });
         });
 
+	abortButton.addEventListener('click', async () => {
+		status.textContent = 'Cancelling...';
+		status.style.color = '#2c3e50';
+		toggleButtons(true);
+		try {
+			const response = await sendAction('/abort', {});
+			const data = await response.json();
+			// 409 means nothing was scheduled, so there is no countdown to keep.
+			if (response.ok || response.status === 409) {
+				clearPending();
+			}
+			status.textContent = data.message;
+			status.style.color = response.ok ? '#2c3e50' : '#c0392b';
+		} catch (err) {
+			status.textContent = 'Failed to contact server.';
+			status.style.color = '#c0392b';
+		} finally {
+			toggleButtons(false);
+		}
+	});
+
+	document.querySelectorAll('[data-wake-target]').forEach(btn => {
+		btn.addEventListener('click', async () => {
+			btn.disabled = true;
+			try {
+				const response = await sendAction('/wake', { target: btn.dataset.wakeTarget });
+				const data = await response.json();
+				status.textContent = data.message;
+				status.style.color = response.ok ? '#2c3e50' : '#c0392b';
+			} catch (err) {
+				status.textContent = 'Failed to contact server.';
+				status.style.color = '#c0392b';
+			} finally {
+				btn.disabled = false;
+			}
+		});
+	});
+
+	function formatRemaining(totalSeconds) {
+		const hours = Math.floor(totalSeconds / 3600);
+		const minutes = Math.floor((totalSeconds % 3600) / 60);
+		const seconds = totalSeconds % 60;
+		const parts = [];
+		if (hours > 0) parts.push(hours + 'h');
+		if (hours > 0 || minutes > 0) parts.push(minutes + 'm');
+		parts.push(seconds + 's');
+		return parts.join(' ');
+	}
+
+	// startCountdown resyncs the local countdown from the server-computed
+	// secondsRemaining so sleeping tabs don't drift.
+	function startCountdown(message, secondsRemaining) {
+		stopCountdown();
+		const deadline = Date.now() + secondsRemaining * 1000;
+		const render = () => {
+			const remaining = Math.max(0, Math.round((deadline - Date.now()) / 1000));
+			status.textContent = message + ' It will run in ' + formatRemaining(remaining) + '.';
+			if (remaining === 0) {
+				clearPending();
+				toggleButtons(busy);
+			}
+		};
+		render();
+		countdownTimer = setInterval(render, 1000);
+	}
+
+	function stopCountdown() {
+		if (countdownTimer !== null) {
+			clearInterval(countdownTimer);
+			countdownTimer = null;
+		}
+	}
+
+	// sendAction posts payload with the stored access token. On 401 it asks
+	// for the token once, remembers it in localStorage and retries.
+	async function sendAction(endpoint, payload, retried = false) {
+		const headers = { 'Content-Type': 'application/json' };
+		const token = localStorage.getItem('windowscontrol-token');
+		if (token) {
+			headers['Authorization'] = 'Bearer ' + token;
+		}
+		const response = await fetch(endpoint, {
+			method: 'POST',
+			headers,
+			body: JSON.stringify(payload)
+		});
+		if (response.status !== 401 || retried) {
+			return response;
+		}
+		const entered = prompt(token ? 'The saved access token was rejected. Enter the access token:' : 'This server requires an access token. Enter it to continue:');
+		if (!entered) {
+			return response;
+		}
+		localStorage.setItem('windowscontrol-token', entered.trim());
+		return sendAction(endpoint, payload, true);
+	}
+
+	// sendConfirmed sends an action and, when the server arms it instead of
+	// running it, waits for the Confirm button before sending it again with
+	// the token. It resolves to null if the confirmation window runs out.
+	async function sendConfirmed(endpoint, payload, prompt) {
+		const response = await sendAction(endpoint, payload);
+		if (response.status !== 202) {
+			return response;
+		}
+		const armed = await response.json();
+		if (!await waitForConfirmation(prompt, armed.expiresInSeconds)) {
+			return null;
+		}
+		status.textContent = 'Sending command...';
+		return sendAction(endpoint, { ...payload, confirmToken: armed.confirmToken });
+	}
+
+	function waitForConfirmation(prompt, seconds) {
+		return new Promise(resolve => {
+			const deadline = Date.now() + seconds * 1000;
+			let timer = null;
+			const finish = confirmed => {
+				clearInterval(timer);
+				confirmButton.hidden = true;
+				confirmButton.onclick = null;
+				resolve(confirmed);
+			};
+			const render = () => {
+				const remaining = Math.max(0, Math.round((deadline - Date.now()) / 1000));
+				status.textContent = prompt + ' Press Confirm within ' + remaining + 's.';
+				if (remaining === 0) {
+					finish(false);
+				}
+			};
+			confirmButton.onclick = () => finish(true);
+			confirmButton.hidden = false;
+			render();
+			timer = setInterval(render, 1000);
+		});
+	}
+
+	// subscribeToEvents follows actions staged, fired or cancelled from any
+	// browser or the console. EventSource reconnects on its own, and every
+	// connection starts with a status snapshot.
+	function subscribeToEvents() {
+		const source = new EventSource('/events');
+		source.onmessage = message => handleEvent(JSON.parse(message.data));
+	}
+
+	function handleEvent(event) {
+		switch (event.type) {
+		case 'status':
+			if (event.action && event.firesAt !== pendingFiresAt) {
+				pendingAction = event.action;
+				pendingFiresAt = event.firesAt;
+				startCountdown('Pending action: ' + event.action + '.', event.remainingSeconds);
+			} else if (!event.action && pendingAction) {
+				status.textContent = 'The pending ' + pendingAction + ' is no longer scheduled.';
+				clearPending();
+			}
+			break;
+		case 'staged':
+			if (event.firesAt === ownFiresAt) {
+				break;
+			}
+			status.style.color = '#2c3e50';
+			if (event.remainingSeconds > 0) {
+				pendingAction = event.action;
+				pendingFiresAt = event.firesAt;
+				startCountdown(event.client + ' staged ' + event.action + '.', event.remainingSeconds);
+			} else {
+				clearPending();
+				status.textContent = event.client + ' ran ' + event.action + '.';
+			}
+			break;
+		case 'cancelled':
+			if (pendingAction || event.action) {
+				status.style.color = '#2c3e50';
+				status.textContent = 'The pending ' + (event.action || 'action') + ' was cancelled by ' + event.client + '.';
+			}
+			clearPending();
+			break;
+		case 'fired':
+			clearPending();
+			status.style.color = '#2c3e50';
+			status.textContent = 'The ' + event.action + ' is running now.';
+			break;
+		}
+		if (event.type === 'staged' || event.type === 'cancelled') {
+			loadActivity();
+		}
+		toggleButtons(busy);
+	}
+
+	// loadActivity lists the latest audit log entries under Recent activity.
+	async function loadActivity() {
+		try {
+			const token = localStorage.getItem('windowscontrol-token');
+			const response = await fetch('/audit?limit=10', token ? { headers: { 'Authorization': 'Bearer ' + token } } : {});
+			const list = document.getElementById('activity-list');
+			if (response.status === 401) {
+				const item = document.createElement('li');
+				item.textContent = 'Recent activity is shown once the access token has been entered for an action.';
+				list.replaceChildren(item);
+				return;
+			}
+			if (!response.ok) {
+				return;
+			}
+			const data = await response.json();
+			list.replaceChildren();
+			data.entries.forEach(entry => {
+				const item = document.createElement('li');
+				item.textContent = new Date(entry.time).toLocaleString() + ': ' +
+					(entry.action || 'external shutdown') + ' ' + entry.outcome +
+					(entry.delaySeconds > 0 ? ' (' + formatRemaining(entry.delaySeconds) + ' delay)' : '') +
+					' by ' + entry.client;
+				list.appendChild(item);
+			});
+			if (!data.entries.length) {
+				const item = document.createElement('li');
+				item.textContent = 'Nothing recorded yet.';
+				list.appendChild(item);
+			}
+		} catch (err) {
+			// The activity list is informational; leave it as it was.
+		}
+	}
+
+	function clearPending() {
+		pendingAction = '';
+		pendingFiresAt = '';
+		stopCountdown();
+	}
+
+	// loadSystemInfo renders the info panel from /sysinfo and returns a
+	// warning to put in front of a confirmation when someone is signed in.
+	async function loadSystemInfo() {
+		try {
+			const token = localStorage.getItem('windowscontrol-token');
+			const response = await fetch('/sysinfo', token ? { headers: { 'Authorization': 'Bearer ' + token } } : {});
+			if (!response.ok) {
+				return '';
+			}
+			const info = await response.json();
+			const panel = document.getElementById('sysinfo');
+			panel.replaceChildren();
+			const line = (text, className) => {
+				const div = document.createElement('div');
+				div.textContent = text;
+				if (className) {
+					div.className = className;
+				}
+				panel.appendChild(div);
+			};
+			line(info.hostname + (info.os ? ' \u2014 ' + info.os : ''));
+			if (info.uptimeSeconds !== null) {
+				line('Up for ' + formatRemaining(info.uptimeSeconds) + '.');
+			}
+			if (info.power && info.power.hasBattery) {
+				line((info.power.acOnline === false ? 'On battery' : 'Plugged in') +
+					(info.power.batteryPercent !== null ? ', ' + info.power.batteryPercent + '%' : '') +
+					(info.power.charging ? ', charging.' : '.'));
+			}
+			if (info.rebootPending) {
+				line('A restart is already pending to finish installing updates.');
+			}
+			let warning = '';
+			if (info.sessions) {
+				const active = info.sessions.filter(session => session.state === 'active');
+				const names = info.sessions.map(session => session.user + (session.console ? ' (console)' : '') + (session.state === 'disconnected' ? ' (disconnected)' : ''));
+				line(names.length ? 'Signed in: ' + names.join(', ') + '.' : 'Nobody is signed in.');
+				if (active.length) {
+					warning = 'Warning: ' + active.map(session => session.user).join(', ') + (active.length === 1 ? ' is' : ' are') + ' signed in and may lose unsaved work.\n\n';
+					line(warning.trim(), 'warning');
+				}
+			} else if (info.sessionCount !== null) {
+				// Without the access token only the counts are reported.
+				line(info.sessionCount ? info.sessionCount + (info.sessionCount === 1 ? ' session is' : ' sessions are') + ' signed in.' : 'Nobody is signed in.');
+				if (info.activeSessionCount) {
+					warning = 'Warning: ' + (info.activeSessionCount === 1 ? 'someone is' : info.activeSessionCount + ' users are') + ' signed in and may lose unsaved work.\n\n';
+					line(warning.trim(), 'warning');
+				}
+			}
+			panel.hidden = false;
+			return warning;
+		} catch (err) {
+			return '';
+		}
+	}
+
+	async function checkStorageHealth() {
+		try {
+			const response = await fetch('/api/system/storage-health');
+			if (!response.ok) {
+				return;
+			}
+			const health = await response.json();
+			if (health.verdict === 'ok') {
+				return;
+			}
+			const freeGB = (health.freeBytes / 1e9).toFixed(1);
+			const banner = document.getElementById('storage-warning');
+			banner.textContent = 'System drive ' + health.volume + ' is ' + Math.round(health.usedPercent) + '% full (' + freeGB + ' GB free). A reboot may not come back cleanly.';
+			banner.hidden = false;
+		} catch (err) {
+			// Storage health is advisory; ignore hosts that can't report it.
+		}
+	}
+
+	async function loadBootOptions() {
+		try {
+			const response = await fetch('/api/firmware/bootoptions');
+			if (!response.ok) {
+				return;
+			}
+			const data = await response.json();
+			data.bootOptions.filter(option => option.active).forEach(option => {
+				const item = document.createElement('option');
+				item.value = option.id;
+				item.textContent = option.description;
+				bootEntrySelect.appendChild(item);
+			});
+			document.getElementById('boot-next').hidden = bootEntrySelect.options.length === 0;
+		} catch (err) {
+			// Leave the boot entry picker hidden when the host can't list entries.
+		}
+	}
+
+	// toggleButtons also keeps the actions disabled while one is pending,
+	// which has to be cancelled before staging another.
 	function toggleButtons(disabled) {
 		actions.forEach(action => {
-			document.getElementById(action.id).disabled = disabled;
+			const btn = document.getElementById(action.id);
+			btn.disabled = disabled || !!pendingAction || btn.classList.contains('locked');
 		});
+		busy = disabled;
+		abortButton.disabled = disabled || !pendingAction;
 		delayPresets.forEach(btn => btn.disabled = disabled);
 		delayMinutesInput.disabled = disabled;
+		delayAtInput.disabled = disabled;
+		bootEntrySelect.disabled = disabled;
+		restoreAppsCheckbox.disabled = disabled;
+		safeModeNetworkCheckbox.disabled = disabled;
+		commentInput.disabled = disabled;
 	}
     </script>
 </body>
 </html>`))
 
 func main() {
-	handled, err := maybeRunService()
+	repl := flag.Bool("repl", false, `read commands such as "shutdown 10m" from the terminal while serving`)
+	configPath := flag.String("config", "", "read settings from this JSON file (default "+configFileName+" next to the executable, if present)")
+	listen := flag.String("listen", "", "address to listen on (default "+defaultListenAddr+")")
+	token := flag.String("token", "", "require this bearer token on POST requests (default $"+tokenEnv+")")
+	logFile := flag.String("log-file", "", "also append log output to this file")
+	trustProxy := flag.Bool("trust-proxy", false, "take the client address from X-Forwarded-For when checking allowedClients")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with this PEM certificate (needs -tls-key)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "serve HTTPS with a self-signed certificate generated on first run")
+	httpRedirect := flag.String("http-redirect", "", "also listen for plain HTTP on this address and redirect it to HTTPS, e.g. :8080")
+	auditLogPath := flag.String("audit-log", "", "record power actions in this JSON-lines file (default "+auditFileName+" next to the executable, or under ProgramData for the service)")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath, config{
+		Listen:        *listen,
+		Token:         *token,
+		LogFile:       *logFile,
+		TrustProxy:    *trustProxy,
+		TLSCert:       *tlsCert,
+		TLSKey:        *tlsKey,
+		TLSSelfSigned: *tlsSelfSigned,
+		HTTPRedirect:  *httpRedirect,
+		AuditLog:      *auditLogPath,
+	})
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if delays, err = cfg.delaySettings(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if storageLimits, err = cfg.storageThresholds(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	wakeTargets = cfg.WakeTargets
+	requireConfirmation = cfg.ConfirmActions
+	if cfg.AuditLog == "" {
+		if cfg.AuditLog, err = defaultAuditLogPath(); err != nil {
+			log.Fatalf("config: locate audit log: %v", err)
+		}
+	}
+	audit = newAuditLog(cfg.AuditLog, cfg.AuditLogMaxBytes)
+	if cfg.LogFile != "" {
+		closer, err := openLogFile(cfg.LogFile)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		defer closer.Close()
+	}
+
+	warnIfEmulated()
+	logPolicyRestrictions()
+
+	handled, err := maybeRunService(cfg)
 	if err != nil {
 		log.Fatalf("service initialization failed: %v", err)
 	}
@@ -225,112 +894,644 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if err := runHTTPServer(ctx); err != nil {
+	if *repl {
+		if stdinIsTerminal() {
+			go runREPL(ctx, newMux(), os.Stdin, os.Stdout, stop)
+		} else {
+			log.Printf("stdin is not a terminal; ignoring -repl")
+		}
+	}
+
+	if err := runHTTPServer(ctx, cfg); err != nil {
 		log.Fatalf("server failed: %v", err)
 	}
 }
 
-func runHTTPServer(ctx context.Context) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if err := pageTemplate.Execute(w, nil); err != nil {
-			log.Printf("render template: %v", err)
-		}
-	})
-	mux.HandleFunc("/shutdown", shutdownHandler)
-	mux.HandleFunc("/restart", restartHandler)
-	mux.HandleFunc("/restart-bios", restartFirmwareHandler)
+// warnIfEmulated logs a warning when the binary's architecture doesn't match
+// the host's, e.g. the amd64 build deployed on an ARM64 machine.
+func warnIfEmulated() {
+	native, err := nativeArch()
+	if err != nil {
+		log.Printf("detect native architecture: %v", err)
+		return
+	}
+	if native != runtime.GOARCH {
+		log.Printf("warning: this %s build is running emulated on a native %s host; use the %s build for reliable power control", runtime.GOARCH, native, native)
+	}
+}
 
-	srv := &http.Server{Addr: listenAddr, Handler: logRequests(mux)}
+// pageData is what the index template renders from. Locked maps actions
+// blocked by policy to the tooltip explaining why. PendingAction is empty
+// unless a delayed action staged by this server can still be cancelled.
+type pageData struct {
+	Locked         map[string]string
+	UpdatesReady   bool
+	Delays         delaySettings
+	WakeTargets    []wakeTarget
+	ConfirmActions bool
+	PendingAction  string
+	PendingSeconds int
+}
 
+func runHTTPServer(ctx context.Context, cfg config) error {
+	allowlist, err := newClientAllowlist(cfg)
+	if err != nil {
+		return err
+	}
+	serverAllowlist = allowlist
+	mux := newMux()
+	srv := &http.Server{Addr: cfg.Listen, Handler: logRequests(mux, allowClients(allowlist, requireToken(cfg.Token, mux)))}
+	servers := []*http.Server{srv}
+	scheme := "http"
+	if cfg.tlsEnabled() {
+		cert, err := serverCertificate(cfg)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		scheme = "https"
+	}
+	// Open /events streams would otherwise keep Shutdown waiting.
+	srv.RegisterOnShutdown(events.close)
+	var redirect *http.Server
+	if cfg.HTTPRedirect != "" {
+		_, httpsPort, _ := net.SplitHostPort(cfg.Listen)
+		redirect = &http.Server{Addr: cfg.HTTPRedirect, Handler: redirectToHTTPS(httpsPort)}
+		servers = append(servers, redirect)
+	}
+
+	drained := make(chan struct{})
 	go func() {
+		defer close(drained)
 		<-ctx.Done()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("graceful shutdown error: %v", err)
+		for _, s := range servers {
+			if err := s.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("graceful shutdown error: %v", err)
+			}
 		}
 	}()
 
-	log.Printf("Windows control web server listening on %s", listenAddr)
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	log.Printf("Windows control web server listening on %s", cfg.Listen)
+	if cfg.Token == "" {
+		log.Printf("no access token set; anyone who can reach the server can use it")
+	} else if scheme == "http" {
+		log.Printf("serving plain HTTP; the access token crosses the network unencrypted")
+	}
+	for _, url := range advertisedURLs(scheme, cfg.Listen) {
+		log.Printf("  reachable at %s", url)
+	}
+
+	errs := make(chan error, len(servers))
+	go func() {
+		if scheme == "https" {
+			errs <- srv.ListenAndServeTLS("", "")
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+	if redirect != nil {
+		log.Printf("redirecting plain HTTP on %s to HTTPS", cfg.HTTPRedirect)
+		go func() { errs <- redirect.ListenAndServe() }()
+	}
+	// A listener that fails takes the others down with it, so a redirect
+	// port that fails to bind isn't silently missing. Otherwise the servers
+	// were shut down, and in-flight requests get the rest of the drain.
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		for _, s := range servers {
+			s.Close()
+		}
 		return err
 	}
+	<-drained
 	return nil
 }
 
-func shutdownHandler(w http.ResponseWriter, r *http.Request) {
-	handlePowerAction(w, r, []string{"/s"}, "Shutdown command staged. The machine is powering off.")
-}
-
-func restartHandler(w http.ResponseWriter, r *http.Request) {
-	handlePowerAction(w, r, []string{"/r"}, "Restart command staged. The machine is restarting.")
-}
-
-func restartFirmwareHandler(w http.ResponseWriter, r *http.Request) {
-	handlePowerAction(w, r, []string{"/r", "/fw"}, "Firmware restart command staged. The machine will reboot into BIOS/UEFI.")
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		ready, err := updatesReadyToInstall()
+		if err != nil {
+			log.Printf("check for staged updates: %v", err)
+		}
+		data := pageData{Locked: lockedActions(), UpdatesReady: ready, Delays: delays, WakeTargets: wakeTargets, ConfirmActions: requireConfirmation}
+		if pending, ok := pendingActions.current(); ok {
+			data.PendingAction = pending.action
+			data.PendingSeconds = secondsUntil(pending.firesAt)
+		}
+		if err := pageTemplate.Execute(w, data); err != nil {
+			log.Printf("render template: %v", err)
+		}
+	})
+	for _, action := range actionTable {
+		mux.HandleFunc(action.path, actionPathHandler(action))
+	}
+	mux.HandleFunc("/api/v1/actions", actionsV1Handler)
+	mux.HandleFunc("/api/v1/openapi.json", openAPIHandler)
+	mux.HandleFunc("/abort", abortHandler)
+	mux.HandleFunc("/status", statusHandler)
+	mux.HandleFunc("/events", eventsHandler)
+	mux.HandleFunc("/sysinfo", sysinfoHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/audit", auditHandler)
+	mux.HandleFunc("/wake", wakeHandler)
+	mux.HandleFunc("/wake/targets", wakeTargetsHandler)
+	mux.HandleFunc("/api/capabilities", capabilitiesHandler)
+	mux.HandleFunc("/api/system/wake-source", wakeSourceHandler)
+	mux.HandleFunc("/api/system/storage-health", storageHealthHandler)
+	mux.HandleFunc("/api/system/restart-manager", restartManagerHandler)
+	mux.HandleFunc("/api/power/buttons", powerButtonsHandler)
+	mux.HandleFunc("/api/firmware/bootoptions", bootOptionsHandler)
+	return mux
 }
 
-func handlePowerAction(w http.ResponseWriter, r *http.Request, baseArgs []string, successMessage string) {
+// abortHandler cancels actions staged on a server-side timer, such as sleep
+// or lock, and a pending shutdown or restart. Like shutdown /a from a
+// prompt, this also cancels a shutdown scheduled by another tool.
+func abortHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if runtime.GOOS != "windows" {
-		writeJSON(w, http.StatusNotImplemented, map[string]string{
-			"message": "Power control commands are available only on Windows hosts.",
-		})
+	if !checkPowerPlatform(w) {
+		return
+	}
+
+	if !claimPowerCommand(w, "abort") {
 		return
 	}
+	defer powerCommands.release()
 
-	delaySeconds, err := parseDelay(r)
+	pending, tracked := pendingActions.current()
+	deferredCancelled := cancelDeferred()
+	err := power.Abort()
+	if err == nil || commandExitCode(err) == errNoShutdownInProgress {
+		externalReboot.Store(false)
+	}
+	if commandExitCode(err) == errNoShutdownInProgress {
+		if !deferredCancelled {
+			pendingActions.clear()
+			writeJSON(w, http.StatusConflict, map[string]string{
+				"message": "Nothing is scheduled, so there was nothing to cancel.",
+			})
+			return
+		}
+		err = nil
+	}
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{
-			"message": err.Error(),
-		})
+		log.Printf("abort shutdown failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, withErrorCode(map[string]interface{}{
+			"message": "Failed to cancel the pending action.",
+		}, err))
 		return
 	}
+	pendingActions.clear()
+	events.publish(actionEvent{Type: "cancelled", Action: pending.action, Client: requestClient(r)})
+	audit.record(r, pending.action, "cancelled", 0, 0)
+	// Checked on every abort rather than only for a tracked safe mode
+	// restart, which a server restart would have forgotten.
+	if err := boot.ClearSafeBoot(); err != nil {
+		log.Printf("clear safe mode boot flag after abort: %v", err)
+	}
+	resumeSuspendedBitLocker()
 
-	args := append([]string{}, baseArgs...)
-	args = append(args, "/t", strconv.Itoa(delaySeconds))
-	cmd := exec.Command("shutdown", args...)
-	if err := cmd.Run(); err != nil {
-		log.Printf("power command failed (%v): %v", args, err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{
-			"message": "Failed to execute power command.",
+	if !tracked {
+		message := "Cancelled a shutdown or restart that was scheduled outside WindowsControl."
+		if deferredCancelled {
+			message = "Cancelled the pending action."
+		}
+		writeJSON(w, http.StatusOK, map[string]string{
+			"message": message,
 		})
 		return
 	}
-
-	message := successMessage
-	if delaySeconds > 0 {
-		delay := time.Duration(delaySeconds) * time.Second
-		message = fmt.Sprintf("%s It will run in %s.", successMessage, delay.Round(time.Second))
+	if pending.action == "restart-boot-entry" {
+		// The one-time boot entry would otherwise apply to the next reboot.
+		if err := boot.ClearBootNext(); err != nil {
+			log.Printf("clear BootNext after abort: %v", err)
+		}
 	}
 	writeJSON(w, http.StatusOK, map[string]string{
-		"message": message,
+		"message":   fmt.Sprintf("Cancelled the pending %s.", pending.action),
+		"cancelled": pending.action,
+	})
+}
+
+// statusHandler reports the delayed action this server staged and how long
+// is left, or a null action when nothing is pending.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	external := externalReboot.Load()
+	pending, ok := pendingActions.current()
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"action": nil, "externalRebootPending": external})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action":                pending.action,
+		"firesAt":               pending.firesAt.UTC().Format(time.RFC3339),
+		"remainingSeconds":      secondsUntil(pending.firesAt),
+		"externalRebootPending": external,
+	})
+}
+
+// powerCommand stages a power action for a parsed request.
+type powerCommand func(req actionRequest) error
+
+// requestError rejects a request from inside a command before anything is
+// staged. It is answered with its status and never retried. A non-empty code
+// is included as "error" so clients can react without parsing the message.
+type requestError struct {
+	status  int
+	message string
+	code    string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// writeRequestError answers with a requestError's status and code. Any other
+// error is treated as a malformed request.
+func writeRequestError(w http.ResponseWriter, err error) {
+	rejected := &requestError{status: http.StatusBadRequest, message: err.Error(), code: "invalid_request"}
+	errors.As(err, &rejected)
+	payload := map[string]string{"message": rejected.message}
+	if rejected.code != "" {
+		payload["error"] = rejected.code
+	}
+	writeJSON(w, rejected.status, payload)
+}
+
+// powerControlAvailable reports whether this host can run power commands.
+// Tests turn it on to drive the handlers against a fake controller.
+var powerControlAvailable = runtime.GOOS == "windows"
+
+// checkPowerPlatform answers 501 and returns false on hosts that can't run
+// power commands.
+func checkPowerPlatform(w http.ResponseWriter) bool {
+	if powerControlAvailable {
+		return true
+	}
+	writeJSON(w, http.StatusNotImplemented, map[string]string{
+		"message": "Power control commands are available only on Windows hosts.",
+		"error":   "unsupported_platform",
+	})
+	return false
+}
+
+// claimPowerCommand acquires the command guard for action, answering 409 and
+// returning false when another command is still running.
+func claimPowerCommand(w http.ResponseWriter, action string) bool {
+	inFlight, ok := powerCommands.acquire(action)
+	if !ok {
+		metrics.observeBusy(action)
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"message":  fmt.Sprintf("Another power command (%s) is already running. Try again shortly.", inFlight),
+			"error":    "command_in_flight",
+			"inFlight": inFlight,
+		})
+	}
+	return ok
+}
+
+// executePowerAction runs command for an already parsed and guarded request
+// and writes the response. It reports whether the command was staged.
+func executePowerAction(w http.ResponseWriter, r *http.Request, action string, req actionRequest, command powerCommand, successMessage string) bool {
+	outcome, attempts := "failed", 0
+	defer func() {
+		metrics.observeAction(action, outcome)
+		audit.record(r, action, outcome, req.DelaySeconds, attempts)
+	}()
+
+	// Recorded before the command runs, since an immediate shutdown may not
+	// leave time to record anything after it.
+	audit.record(r, action, "requested", req.DelaySeconds, 0)
+	start := time.Now()
+	attempts, err := runPowerCommand(r.Context(), command, req)
+	var rejected *requestError
+	if errors.As(err, &rejected) {
+		outcome = "rejected"
+		writeRequestError(w, rejected)
+		return false
+	}
+	if commandExitCode(err) == errShutdownIsScheduled {
+		_, own := pendingActions.current()
+		externalReboot.Store(!own)
+		if !req.Override {
+			outcome = "rejected"
+			payload := map[string]interface{}{
+				"message":               "Another shutdown or restart is already scheduled on this machine (for example by Windows Update). Send override: true to cancel it and stage this action instead.",
+				"error":                 "external_reboot_pending",
+				"externalRebootPending": true,
+			}
+			// When the schedule is this server's own, say so: override
+			// would replace it, which is a different decision.
+			if pending, ok := pendingActions.current(); ok {
+				payload["message"] = fmt.Sprintf("This server already has a %s pending in %d seconds. Send override: true to replace it with this action, or abort it first.", pending.action, secondsUntil(pending.firesAt))
+				payload["pendingAction"] = pending.action
+			}
+			writeJSON(w, http.StatusConflict, payload)
+			return false
+		}
+		if err := power.Abort(); err != nil {
+			log.Printf("abort external shutdown failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, withErrorCode(map[string]interface{}{
+				"message": "Failed to cancel the already scheduled shutdown.",
+				"error":   "exec_failed",
+			}, err))
+			return false
+		}
+		externalReboot.Store(false)
+		log.Printf("cancelled an externally scheduled shutdown to stage %s", action)
+		retried, retryErr := runPowerCommand(r.Context(), command, req)
+		attempts += retried
+		err = retryErr
+	}
+	metrics.observeCommand(action, time.Since(start))
+	if err != nil {
+		log.Printf("%s command failed after %d attempt(s): %v", action, attempts, err)
+		writeJSON(w, http.StatusInternalServerError, withErrorCode(map[string]interface{}{
+			"message":  "Failed to execute power command.",
+			"error":    "exec_failed",
+			"attempts": attempts,
+		}, err))
+		return false
+	}
+
+	outcome = "staged"
+	metrics.observeStaged(action, attempts)
+	externalReboot.Store(false)
+	if req.RestoreApps {
+		successMessage += " Only applications registered for restart will be relaunched."
+	}
+	scheduledAt := time.Now().Add(time.Duration(req.DelaySeconds) * time.Second)
+	if req.At != "" {
+		successMessage += fmt.Sprintf(" It will run at %s machine time.", scheduledAt.Local().Format("Mon 15:04"))
+	}
+	if req.DelaySeconds > 0 {
+		pendingActions.set(action, scheduledAt)
+	} else {
+		pendingActions.clear()
+	}
+	events.publish(actionEvent{
+		Type:             "staged",
+		Action:           action,
+		FiresAt:          scheduledAt.UTC().Format(time.RFC3339),
+		RemainingSeconds: secondsUntil(scheduledAt),
+		Client:           requestClient(r),
+	})
+	writeJSON(w, http.StatusOK, actionResult{
+		Action:           action,
+		Message:          successMessage,
+		ScheduledAt:      scheduledAt.UTC().Format(time.RFC3339),
+		SecondsRemaining: secondsUntil(scheduledAt),
+		Attempts:         attempts,
+	})
+	return true
+}
+
+const (
+	maxCommandAttempts  = 3
+	commandRetryBackoff = time.Second
+)
+
+// transientExitCodes are the Win32 errors shutdown.exe and the shutdown APIs
+// report when the RPC endpoint isn't ready yet, typically right after resume
+// on domain-joined machines. Anything else (access denied, invalid
+// arguments) is permanent.
+var transientExitCodes = map[int]bool{
+	1722: true, // RPC_S_SERVER_UNAVAILABLE
+	1723: true, // RPC_S_SERVER_TOO_BUSY
+	1726: true, // RPC_S_CALL_FAILED
+}
+
+// runPowerCommand runs command, retrying transient failures with a doubling
+// backoff. The total wait stays bounded by maxCommandAttempts and is cut
+// short when ctx is done. It returns the number of attempts made.
+func runPowerCommand(ctx context.Context, command powerCommand, req actionRequest) (int, error) {
+	backoff := commandRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := command(req)
+		if err == nil || attempt == maxCommandAttempts || !isTransientCommandError(err) {
+			return attempt, err
+		}
+		log.Printf("power command failed transiently, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+const (
+	// errNoShutdownInProgress is ERROR_NO_SHUTDOWN_IN_PROGRESS, returned by
+	// shutdown /a when there is nothing to cancel.
+	errNoShutdownInProgress = 1116
+	// errShutdownIsScheduled is ERROR_SHUTDOWN_IS_SCHEDULED, returned when
+	// another shutdown or restart is already pending on the machine.
+	errShutdownIsScheduled = 1190
+)
+
+// externalReboot remembers that the last power command found a shutdown or
+// restart scheduled outside this server. Windows can't be asked without
+// trying to schedule one, so /status reports what the 409 path last saw
+// until an action is staged or an abort clears the schedule.
+var externalReboot atomic.Bool
+
+func isTransientCommandError(err error) bool {
+	return transientExitCodes[commandExitCode(err)]
+}
+
+// commandExitCode returns the Win32 error carried by err, either as
+// shutdown.exe's exit code or as a syscall error from a direct API call. It
+// returns -1 when err is nil or carries neither.
+func commandExitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return int(errno)
+	}
+	return -1
+}
+
+// withErrorCode adds the Win32 error behind err to a failure response as
+// errorCode, when there is one.
+func withErrorCode(payload map[string]interface{}, err error) map[string]interface{} {
+	if code := commandExitCode(err); code >= 0 {
+		payload["errorCode"] = code
+	}
+	return payload
+}
+
+// secondsUntil reports the whole seconds left before t, never negative. It is
+// recomputed at response time so clients can resync their countdowns.
+func secondsUntil(t time.Time) int {
+	remaining := time.Until(t).Round(time.Second)
+	if remaining < 0 {
+		return 0
+	}
+	return int(remaining / time.Second)
+}
+
+// commandGuard serializes power command execution so concurrent requests
+// can't interleave shutdown calls and their errors.
+type commandGuard struct {
+	mu       sync.Mutex
+	inFlight string
+}
+
+var powerCommands commandGuard
+
+// acquire claims the guard for action. When another command is running it
+// returns that command's action name and false.
+func (g *commandGuard) acquire(action string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inFlight != "" {
+		return g.inFlight, false
+	}
+	g.inFlight = action
+	return "", true
+}
+
+func (g *commandGuard) release() {
+	g.mu.Lock()
+	g.inFlight = ""
+	g.mu.Unlock()
+}
+
+// pendingTracker remembers the delayed action this server staged last, so
+// the page can offer to cancel it. Immediate actions leave nothing to track.
+type pendingTracker struct {
+	mu      sync.Mutex
+	pending pendingAction
+	// fire announces the pending action on /events when its time comes.
+	fire *time.Timer
+}
+
+type pendingAction struct {
+	action  string
+	firesAt time.Time
+}
+
+var pendingActions pendingTracker
+
+func (t *pendingTracker) set(action string, firesAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fire != nil {
+		t.fire.Stop()
+		t.fire = nil
+	}
+	t.pending = pendingAction{action: action, firesAt: firesAt}
+	if action == "" {
+		return
+	}
+	pending := t.pending
+	t.fire = time.AfterFunc(time.Until(firesAt), func() {
+		t.mu.Lock()
+		current := t.pending == pending
+		t.mu.Unlock()
+		if current {
+			events.publish(actionEvent{Type: "fired", Action: pending.action, FiresAt: firesAt.UTC().Format(time.RFC3339)})
+		}
 	})
 }
 
-func parseDelay(r *http.Request) (int, error) {
-	if r.Body == nil {
-		return 0, nil
+func (t *pendingTracker) clear() {
+	t.set("", time.Time{})
+}
+
+// current returns the tracked action, forgetting it once its fire time has
+// passed.
+func (t *pendingTracker) current() (pendingAction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending.action != "" && !time.Now().Before(t.pending.firesAt) {
+		t.pending = pendingAction{}
 	}
-	defer r.Body.Close()
+	return t.pending, t.pending.action != ""
+}
+
+type actionRequest struct {
+	// Action names the action to run on /api/v1/actions. The per-action
+	// paths only accept their own name here.
+	Action       string `json:"action,omitempty"`
+	DelaySeconds int    `json:"delaySeconds,omitempty"`
+	// At is an RFC3339 timestamp or a local "HH:MM" time, which
+	// parseActionRequest resolves into DelaySeconds.
+	At               string `json:"at,omitempty"`
+	Override         bool   `json:"override"`
+	RestoreApps      bool   `json:"restoreApps,omitempty"`
+	SuspendBitLocker bool   `json:"suspendBitLocker,omitempty"`
+	// IgnoreBitLocker accepts the recovery key risk of a firmware-related
+	// restart without suspending protection.
+	IgnoreBitLocker bool   `json:"ignoreBitLocker,omitempty"`
+	BootEntry       string `json:"bootEntry,omitempty"`
+	// Network picks safe mode with networking for restart-safemode.
+	Network bool `json:"network,omitempty"`
+	// Comment is shown to signed-in users and Reason names a
+	// shutdownReasons entry; both are recorded by the event tracker.
+	Comment string `json:"comment,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	// ConfirmToken completes an action armed by confirmActions.
+	ConfirmToken string `json:"confirmToken,omitempty"`
+}
+
+func parseActionRequest(r *http.Request) (actionRequest, error) {
 	var payload struct {
-		DelaySeconds int `json:"delaySeconds"`
+		actionRequest
+		// DelaySeconds shadows the embedded field so an explicit value can
+		// be told apart from an absent one.
+		DelaySeconds *int `json:"delaySeconds"`
+	}
+	if r.Body != nil {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			return actionRequest{}, &requestError{status: http.StatusBadRequest, message: "invalid request body: " + err.Error(), code: "invalid_request"}
+		}
+	}
+
+	req := payload.actionRequest
+	if payload.DelaySeconds != nil {
+		if req.At != "" {
+			return actionRequest{}, invalidDelay("send either delaySeconds or at, not both")
+		}
+		if *payload.DelaySeconds < 0 {
+			return actionRequest{}, invalidDelay("delaySeconds must be zero or positive")
+		}
+		req.DelaySeconds = *payload.DelaySeconds
 	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		if errors.Is(err, io.EOF) {
-			return 0, nil
+	if req.At != "" {
+		delaySeconds, err := resolveAt(req.At, time.Now())
+		if err != nil {
+			return actionRequest{}, invalidDelay(err.Error())
 		}
-		return 0, fmt.Errorf("invalid request body: %w", err)
+		req.DelaySeconds = delaySeconds
 	}
-	if payload.DelaySeconds < 0 {
-		return 0, errors.New("delaySeconds must be zero or positive")
+	if err := validateShutdownNote(req); err != nil {
+		return actionRequest{}, err
 	}
-	return payload.DelaySeconds, nil
+	if !delays.allows(req.DelaySeconds) {
+		return actionRequest{}, invalidDelay(fmt.Sprintf("a delay of %d seconds is outside %s", req.DelaySeconds, delays.describeBounds()))
+	}
+	return req, nil
+}
+
+func invalidDelay(message string) error {
+	return &requestError{status: http.StatusBadRequest, message: message, code: "invalid_delay"}
 }
 
 func writeJSON(w http.ResponseWriter, statusCode int, payload interface{}) {
@@ -339,9 +1540,19 @@ func writeJSON(w http.ResponseWriter, statusCode int, payload interface{}) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
-func logRequests(next http.Handler) http.Handler {
+// logRequests logs each request with its status and duration and counts it
+// for /metrics. Requests are counted under the routes pattern that matches
+// them, so probes for arbitrary paths don't each get their own series.
+func logRequests(routes *http.ServeMux, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		_, pattern := routes.Handler(r)
+		metrics.observeRequest(pattern, rec.status)
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
 	})
 }
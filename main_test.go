@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// serve sends a request with a JSON body, if any, through the full mux.
+func serve(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, r)
+	return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return payload
+}
+
+func TestAbortAfterDelayedShutdown(t *testing.T) {
+	fake := useFakePower(t)
+	if rec := serve(t, http.MethodPost, "/shutdown", `{"delaySeconds": 1800}`); rec.Code != http.StatusOK {
+		t.Fatalf("shutdown: %d %s", rec.Code, rec.Body)
+	}
+	rec := serve(t, http.MethodPost, "/abort", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("abort: %d %s", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["cancelled"]; got != "shutdown" {
+		t.Errorf("cancelled = %v, want shutdown", got)
+	}
+	if _, pending := pendingActions.current(); pending {
+		t.Error("the shutdown is still tracked after abort")
+	}
+	if calls := fake.called(); len(calls) != 2 || calls[1] != "abort" {
+		t.Errorf("calls = %v, want [shutdown abort]", calls)
+	}
+}
+
+func TestAbortWithNothingPending(t *testing.T) {
+	fake := useFakePower(t)
+	fake.fail("abort", syscall.Errno(errNoShutdownInProgress))
+	rec := serve(t, http.MethodPost, "/abort", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("abort: %d %s, want 409", rec.Code, rec.Body)
+	}
+}
+
+func TestAbortFailure(t *testing.T) {
+	fake := useFakePower(t)
+	fake.fail("abort", syscall.Errno(5))
+	rec := serve(t, http.MethodPost, "/abort", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("abort: %d %s, want 500", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["errorCode"]; got != float64(5) {
+		t.Errorf("errorCode = %v, want 5", got)
+	}
+}
+
+func TestAbortUnsupportedPlatform(t *testing.T) {
+	useFakePower(t)
+	powerControlAvailable = false
+	rec := serve(t, http.MethodPost, "/abort", "")
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("abort: %d %s, want 501", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["error"]; got != "unsupported_platform" {
+		t.Errorf("error = %v, want unsupported_platform", got)
+	}
+}
+
+// TestPowerEndpoints drives the command endpoints through the mux against
+// the fake controller, so the HTTP surface is covered on every platform.
+func TestPowerEndpoints(t *testing.T) {
+	tests := []struct {
+		path string
+		body string
+		call string
+		want int
+	}{
+		{"/shutdown", "", "shutdown", http.StatusOK},
+		{"/restart", `{"delaySeconds": 60}`, "restart", http.StatusOK},
+		{"/restart-recovery", "", "restart-recovery", http.StatusOK},
+		{"/api/v1/actions", `{"action": "shutdown", "delaySeconds": 300}`, "shutdown", http.StatusOK},
+		{"/shutdown", `{"delaySeconds": -1}`, "", http.StatusBadRequest},
+		{"/shutdown", `{"delaySeconds": 60, "at": "23:00"}`, "", http.StatusBadRequest},
+		{"/restart", `{"delaySeconds": `, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.body, func(t *testing.T) {
+			fake := useFakePower(t)
+			rec := serve(t, http.MethodPost, tt.path, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("%d %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+			calls := fake.called()
+			if tt.call == "" {
+				if len(calls) != 0 {
+					t.Errorf("a rejected request ran %v", calls)
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0] != tt.call {
+				t.Fatalf("calls = %v, want [%s]", calls, tt.call)
+			}
+			payload := decodeBody(t, rec)
+			if payload["action"] != tt.call {
+				t.Errorf("action = %v, want %s", payload["action"], tt.call)
+			}
+			if delay := fake.reqs[0].DelaySeconds; payload["secondsRemaining"] != float64(delay) {
+				t.Errorf("secondsRemaining = %v, want %d", payload["secondsRemaining"], delay)
+			}
+		})
+	}
+}
+
+func TestPowerEndpointsUnsupportedPlatform(t *testing.T) {
+	fake := useFakePower(t)
+	powerControlAvailable = false
+	for _, action := range actionTable {
+		if rec := serve(t, http.MethodPost, action.path, ""); rec.Code != http.StatusNotImplemented {
+			t.Errorf("%s: %d, want 501", action.path, rec.Code)
+		}
+	}
+	if rec := serve(t, http.MethodPost, "/api/v1/actions", `{"action": "shutdown"}`); rec.Code != http.StatusNotImplemented {
+		t.Errorf("/api/v1/actions: %d, want 501", rec.Code)
+	}
+	if calls := fake.called(); len(calls) != 0 {
+		t.Errorf("calls = %v on an unsupported platform", calls)
+	}
+
+	rec := serve(t, http.MethodGet, "/api/v1/actions", "")
+	if actions := decodeBody(t, rec)["actions"]; rec.Code != http.StatusOK || len(actions.([]interface{})) != 0 {
+		t.Errorf("GET /api/v1/actions = %d %v, want no actions", rec.Code, actions)
+	}
+	rec = serve(t, http.MethodGet, "/api/capabilities", "")
+	if got := decodeBody(t, rec)["powerControl"]; rec.Code != http.StatusOK || got != false {
+		t.Errorf("capabilities = %d powerControl %v, want false", rec.Code, got)
+	}
+}
+
+func TestHandlersRejectWrongMethod(t *testing.T) {
+	useFakePower(t)
+	for _, path := range []string{"/shutdown", "/restart", "/abort"} {
+		if rec := serve(t, http.MethodGet, path, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: %d, want 405", path, rec.Code)
+		}
+	}
+	for _, path := range []string{"/status", "/audit", "/api/capabilities"} {
+		if rec := serve(t, http.MethodPost, path, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST %s: %d, want 405", path, rec.Code)
+		}
+	}
+}
+
+func TestCommandGuardAdmitsOne(t *testing.T) {
+	var guard commandGuard
+	const contenders = 64
+	var (
+		wg       sync.WaitGroup
+		start    = make(chan struct{})
+		acquired atomic.Int32
+	)
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if inFlight, ok := guard.acquire(fmt.Sprintf("action-%d", i)); ok {
+				acquired.Add(1)
+			} else if inFlight == "" {
+				t.Error("a refused acquire did not name the command in flight")
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	if n := acquired.Load(); n != 1 {
+		t.Fatalf("%d goroutines acquired the guard, want 1", n)
+	}
+	guard.release()
+	if _, ok := guard.acquire("again"); !ok {
+		t.Error("the guard can't be acquired after release")
+	}
+}
+
+// TestConcurrentPowerRequests fires parallel requests while the first
+// command is still running: exactly one runs and the rest get 409.
+func TestConcurrentPowerRequests(t *testing.T) {
+	fake := useFakePower(t)
+	fake.hold = make(chan struct{})
+	const requests = 16
+	codes := make(chan *httptest.ResponseRecorder, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			codes <- serve(t, http.MethodPost, "/shutdown", "")
+		}()
+	}
+
+	// The request holding the guard is blocked in the fake, so every
+	// other one answers first.
+	for i := 0; i < requests-1; i++ {
+		rec := <-codes
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("concurrent request: %d %s, want 409", rec.Code, rec.Body)
+		}
+		payload := decodeBody(t, rec)
+		if payload["error"] != "command_in_flight" || payload["inFlight"] != "shutdown" {
+			t.Errorf("payload = %v, want command_in_flight naming shutdown", payload)
+		}
+	}
+	close(fake.hold)
+	if rec := <-codes; rec.Code != http.StatusOK {
+		t.Fatalf("guarded request: %d %s, want 200", rec.Code, rec.Body)
+	}
+	if calls := fake.called(); len(calls) != 1 {
+		t.Errorf("calls = %v, want a single shutdown", calls)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		action        string
+		in            time.Duration
+		wait          time.Duration
+		wantAction    interface{}
+		wantRemaining float64
+	}{
+		{"nothing pending", "", 0, 0, nil, 0},
+		{"pending restart", "restart", 90 * time.Second, 0, "restart", 90},
+		{"clears itself after firesAt", "shutdown", 20 * time.Millisecond, 50 * time.Millisecond, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakePower(t)
+			firesAt := time.Now().Add(tt.in)
+			if tt.action != "" {
+				pendingActions.set(tt.action, firesAt)
+			}
+			time.Sleep(tt.wait)
+
+			rec := serve(t, http.MethodGet, "/status", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%d %s", rec.Code, rec.Body)
+			}
+			payload := decodeBody(t, rec)
+			if payload["action"] != tt.wantAction {
+				t.Fatalf("action = %v, want %v", payload["action"], tt.wantAction)
+			}
+			if tt.wantAction == nil {
+				if len(payload) != 2 || payload["externalRebootPending"] != false {
+					t.Errorf("payload = %v, want only a null action and externalRebootPending false", payload)
+				}
+				return
+			}
+			if payload["remainingSeconds"] != tt.wantRemaining {
+				t.Errorf("remainingSeconds = %v, want %v", payload["remainingSeconds"], tt.wantRemaining)
+			}
+			if want := firesAt.UTC().Format(time.RFC3339); payload["firesAt"] != want {
+				t.Errorf("firesAt = %v, want %s", payload["firesAt"], want)
+			}
+		})
+	}
+}
+
+func TestStatusTracksStagedAction(t *testing.T) {
+	useFakePower(t)
+	if rec := serve(t, http.MethodPost, "/restart", `{"delaySeconds": 120}`); rec.Code != http.StatusOK {
+		t.Fatalf("restart: %d %s", rec.Code, rec.Body)
+	}
+	payload := decodeBody(t, serve(t, http.MethodGet, "/status", ""))
+	if payload["action"] != "restart" || payload["remainingSeconds"] != float64(120) {
+		t.Errorf("status = %v, want restart with 120 seconds left", payload)
+	}
+
+	if rec := serve(t, http.MethodPost, "/shutdown", ""); rec.Code != http.StatusOK {
+		t.Fatalf("shutdown: %d %s", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, serve(t, http.MethodGet, "/status", ""))["action"]; got != nil {
+		t.Errorf("action = %v after an immediate shutdown replaced the restart, want null", got)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandDurationBuckets are the upper bounds, in seconds, of the command
+// latency histogram. Retries back off by whole seconds, so the top buckets
+// catch commands that needed them.
+var commandDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type requestKey struct {
+	path string
+	code int
+}
+
+type actionKey struct {
+	action  string
+	outcome string
+}
+
+type histogram struct {
+	// counts holds one count per bucket, not yet cumulative.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// serverMetrics accumulates the counters served on GET /metrics.
+type serverMetrics struct {
+	mu               sync.Mutex
+	requests         map[requestKey]uint64
+	actions          map[actionKey]uint64
+	commandDurations map[string]*histogram
+	// staged splits staged actions by whether the first attempt worked;
+	// the outcome is "first" or "retried".
+	staged map[actionKey]uint64
+	// busy counts requests turned away because another command was running.
+	busy map[string]uint64
+}
+
+var metrics serverMetrics
+
+// observeRequest counts a finished request to the route pattern path.
+func (m *serverMetrics) observeRequest(path string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == nil {
+		m.requests = make(map[requestKey]uint64)
+	}
+	m.requests[requestKey{path, code}]++
+}
+
+// observeAction counts a power action that reached execution. outcome is
+// "staged", "rejected" or "failed".
+func (m *serverMetrics) observeAction(action, outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.actions == nil {
+		m.actions = make(map[actionKey]uint64)
+	}
+	m.actions[actionKey{action, outcome}]++
+}
+
+// observeStaged counts a staged action by the attempts its command took.
+func (m *serverMetrics) observeStaged(action string, attempts int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.staged == nil {
+		m.staged = make(map[actionKey]uint64)
+	}
+	outcome := "first"
+	if attempts > 1 {
+		outcome = "retried"
+	}
+	m.staged[actionKey{action, outcome}]++
+}
+
+// observeBusy counts a request for action rejected because another power
+// command held the guard.
+func (m *serverMetrics) observeBusy(action string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.busy == nil {
+		m.busy = make(map[string]uint64)
+	}
+	m.busy[action]++
+}
+
+// observeCommand records how long running action's command took, retries
+// included.
+func (m *serverMetrics) observeCommand(action string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.commandDurations == nil {
+		m.commandDurations = make(map[string]*histogram)
+	}
+	h, ok := m.commandDurations[action]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(commandDurationBuckets))}
+		m.commandDurations[action] = h
+	}
+	seconds := d.Seconds()
+	for i, bound := range commandDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// writeTo writes the metrics in the Prometheus text exposition format,
+// sorted so consecutive scrapes diff cleanly.
+func (m *serverMetrics) writeTo(w io.Writer, pending bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP windowscontrol_http_requests_total HTTP requests served, by route and status code.")
+	fmt.Fprintln(w, "# TYPE windowscontrol_http_requests_total counter")
+	requests := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requests = append(requests, key)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].path != requests[j].path {
+			return requests[i].path < requests[j].path
+		}
+		return requests[i].code < requests[j].code
+	})
+	for _, key := range requests {
+		fmt.Fprintf(w, "windowscontrol_http_requests_total{path=%s,code=\"%d\"} %d\n", quoteLabel(key.path), key.code, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP windowscontrol_power_actions_total Power actions executed, by action and outcome.")
+	fmt.Fprintln(w, "# TYPE windowscontrol_power_actions_total counter")
+	writeActionCounts(w, "windowscontrol_power_actions_total", "outcome", m.actions)
+
+	fmt.Fprintln(w, "# HELP windowscontrol_power_actions_staged_total Staged power actions, by whether the first attempt succeeded or a retry was needed.")
+	fmt.Fprintln(w, "# TYPE windowscontrol_power_actions_staged_total counter")
+	writeActionCounts(w, "windowscontrol_power_actions_staged_total", "attempts", m.staged)
+
+	fmt.Fprintln(w, "# HELP windowscontrol_power_commands_busy_total Power action requests rejected because another command was running.")
+	fmt.Fprintln(w, "# TYPE windowscontrol_power_commands_busy_total counter")
+	busy := make([]string, 0, len(m.busy))
+	for action := range m.busy {
+		busy = append(busy, action)
+	}
+	sort.Strings(busy)
+	for _, action := range busy {
+		fmt.Fprintf(w, "windowscontrol_power_commands_busy_total{action=%s} %d\n", quoteLabel(action), m.busy[action])
+	}
+
+	fmt.Fprintln(w, "# HELP windowscontrol_command_duration_seconds Time taken to run power commands, including retries.")
+	fmt.Fprintln(w, "# TYPE windowscontrol_command_duration_seconds histogram")
+	names := make([]string, 0, len(m.commandDurations))
+	for name := range m.commandDurations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := m.commandDurations[name]
+		action := quoteLabel(name)
+		var cumulative uint64
+		for i, bound := range commandDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "windowscontrol_command_duration_seconds_bucket{action=%s,le=\"%s\"} %d\n", action, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "windowscontrol_command_duration_seconds_bucket{action=%s,le=\"+Inf\"} %d\n", action, h.count)
+		fmt.Fprintf(w, "windowscontrol_command_duration_seconds_sum{action=%s} %s\n", action, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "windowscontrol_command_duration_seconds_count{action=%s} %d\n", action, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP windowscontrol_action_pending Whether a delayed action staged by this server is pending.")
+	fmt.Fprintln(w, "# TYPE windowscontrol_action_pending gauge")
+	value := 0
+	if pending {
+		value = 1
+	}
+	fmt.Fprintf(w, "windowscontrol_action_pending %d\n", value)
+}
+
+// writeActionCounts writes counts as samples of name labelled with the
+// action and, under label, the outcome.
+func writeActionCounts(w io.Writer, name, label string, counts map[actionKey]uint64) {
+	keys := make([]actionKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].action != keys[j].action {
+			return keys[i].action < keys[j].action
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{action=%s,%s=%s} %d\n", name, quoteLabel(key.action), label, quoteLabel(key.outcome), counts[key])
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, pending := pendingActions.current()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.writeTo(w, pending)
+}
+
+// statusRecorder remembers the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush keeps /events streaming through the recorder.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// scrape parses a /metrics body into sample values keyed by name and labels.
+func scrape(t *testing.T, body string) map[string]float64 {
+	t.Helper()
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("bad sample %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetricsScrape(t *testing.T) {
+	fake := useFakePower(t)
+	metrics = serverMetrics{}
+	t.Cleanup(func() { metrics = serverMetrics{} })
+	captureLog(t)
+
+	mux := newMux()
+	handler := logRequests(mux, mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	do(http.MethodPost, "/shutdown", "")
+	do(http.MethodPost, "/shutdown", `{"delaySeconds": 60}`)
+	fake.fail("restart", syscall.Errno(5))
+	do(http.MethodPost, "/restart", "")
+	fake.fail("restart", syscall.Errno(1726))
+	do(http.MethodPost, "/restart", `{"delaySeconds": 60}`)
+	if _, ok := powerCommands.acquire("shutdown"); !ok {
+		t.Fatal("the command guard is already held")
+	}
+	do(http.MethodPost, "/restart", "")
+	powerCommands.release()
+	do(http.MethodGet, "/status", "")
+	do(http.MethodGet, "/status?verbose=1", "")
+
+	rec := do(http.MethodGet, "/metrics", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics: %d", rec.Code)
+	}
+	samples := scrape(t, rec.Body.String())
+	want := map[string]float64{
+		`windowscontrol_http_requests_total{path="/shutdown",code="200"}`:                2,
+		`windowscontrol_http_requests_total{path="/restart",code="500"}`:                 1,
+		`windowscontrol_http_requests_total{path="/restart",code="409"}`:                 1,
+		`windowscontrol_http_requests_total{path="/status",code="200"}`:                  2,
+		`windowscontrol_power_actions_total{action="shutdown",outcome="staged"}`:         2,
+		`windowscontrol_power_actions_total{action="restart",outcome="failed"}`:          1,
+		`windowscontrol_power_actions_total{action="restart",outcome="staged"}`:          1,
+		`windowscontrol_power_actions_staged_total{action="shutdown",attempts="first"}`:  2,
+		`windowscontrol_power_actions_staged_total{action="restart",attempts="retried"}`: 1,
+		`windowscontrol_power_commands_busy_total{action="restart"}`:                     1,
+		`windowscontrol_command_duration_seconds_count{action="shutdown"}`:               2,
+		`windowscontrol_command_duration_seconds_bucket{action="shutdown",le="+Inf"}`:    2,
+		`windowscontrol_action_pending`:                                                  1,
+	}
+	for key, value := range want {
+		if got, ok := samples[key]; !ok || got != value {
+			t.Errorf("%s = %v (present %v), want %v", key, got, ok, value)
+		}
+	}
+	// The scrape itself is counted only after it has been written.
+	if _, ok := samples[`windowscontrol_http_requests_total{path="/metrics",code="200"}`]; ok {
+		t.Error("the scrape counted itself")
+	}
+}
+
+func TestCommandDurationHistogramIsCumulative(t *testing.T) {
+	var m serverMetrics
+	for _, d := range []time.Duration{20 * time.Millisecond, 70 * time.Millisecond, 70 * time.Millisecond, 3 * time.Second, time.Minute} {
+		m.observeCommand("restart", d)
+	}
+	var body strings.Builder
+	m.writeTo(&body, false)
+	samples := scrape(t, body.String())
+
+	want := map[string]float64{
+		"0.05": 1, "0.1": 3, "0.25": 3, "0.5": 3, "1": 3, "2.5": 3, "5": 4, "10": 4, "30": 4, "+Inf": 5,
+	}
+	previous := 0.0
+	for _, le := range []string{"0.05", "0.1", "0.25", "0.5", "1", "2.5", "5", "10", "30", "+Inf"} {
+		key := `windowscontrol_command_duration_seconds_bucket{action="restart",le="` + le + `"}`
+		got := samples[key]
+		if got != want[le] {
+			t.Errorf("le=%s: %v, want %v", le, got, want[le])
+		}
+		if got < previous {
+			t.Errorf("le=%s: %v is below the previous bucket's %v", le, got, previous)
+		}
+		previous = got
+	}
+	if got := samples[`windowscontrol_command_duration_seconds_count{action="restart"}`]; got != 5 {
+		t.Errorf("count = %v, want 5", got)
+	}
+	if got := samples[`windowscontrol_command_duration_seconds_sum{action="restart"}`]; got < 63.15 || got > 63.17 {
+		t.Errorf("sum = %v, want 63.16", got)
+	}
+	if got := samples["windowscontrol_action_pending"]; got != 0 {
+		t.Errorf("action_pending = %v, want 0", got)
+	}
+}
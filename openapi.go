@@ -0,0 +1,128 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// openAPIHandler serves an OpenAPI description of /api/v1. The schemas are
+// derived from the Go types the handlers encode and decode, so the document
+// can't drift from the code.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
+
+func openAPIDocument() map[string]interface{} {
+	request := schemaOf(reflect.TypeOf(actionRequest{}))
+	names := make([]string, 0, len(actionTable))
+	for _, action := range actionTable {
+		names = append(names, action.name)
+		names = append(names, action.aliases...)
+	}
+	reasons := slices.Sorted(maps.Keys(shutdownReasons))
+	properties := request["properties"].(map[string]interface{})
+	properties["action"] = map[string]interface{}{"type": "string", "enum": names}
+	properties["reason"] = map[string]interface{}{"type": "string", "enum": reasons}
+	properties["comment"] = map[string]interface{}{"type": "string", "maxLength": maxCommentLength}
+	request["required"] = []string{"action"}
+
+	errorResponse := func(description string) map[string]interface{} {
+		return jsonResponse(description, "#/components/schemas/ActionError")
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "WindowsControl",
+			"version": "1",
+		},
+		"paths": map[string]interface{}{
+			"/api/v1/actions": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary": "List the actions this host supports",
+					"responses": map[string]interface{}{
+						"200": jsonResponse("Supported actions", "#/components/schemas/ActionList"),
+					},
+				},
+				"post": map[string]interface{}{
+					"summary": "Stage an action",
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"schema": map[string]interface{}{"$ref": "#/components/schemas/ActionRequest"},
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": jsonResponse("The action was staged", "#/components/schemas/ActionResult"),
+						"202": map[string]interface{}{"description": "confirmActions is on: resend the request with the returned confirmToken within expiresInSeconds"},
+						"400": errorResponse("invalid_request, invalid_delay, unknown_action, unknown_boot_entry or invalid_confirmation"),
+						"403": errorResponse("policy_blocked"),
+						"409": errorResponse("command_in_flight, external_reboot_pending, or a state the action needs is missing, e.g. hibernate_unavailable"),
+						"500": errorResponse("exec_failed"),
+						"501": errorResponse("unsupported_platform"),
+					},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"ActionRequest": request,
+				"ActionResult":  schemaOf(reflect.TypeOf(actionResult{})),
+				"ActionList":    schemaOf(reflect.TypeOf(actionList{})),
+				"ActionError":   schemaOf(reflect.TypeOf(actionError{})),
+			},
+		},
+	}
+}
+
+func jsonResponse(description, ref string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": ref},
+			},
+		},
+	}
+}
+
+// schemaOf describes t as a JSON schema, following the encoding/json rules
+// for field names. It covers the kinds the API types use.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+)
+
+type policyRestriction struct {
+	Policy      string   `json:"policy"`
+	Explanation string   `json:"explanation"`
+	Actions     []string `json:"actions"`
+}
+
+// shutdownActions are the actions that end up in InitiateSystemShutdown or
+// SetSuspendState and therefore need the "Shut down the system" user right.
+var shutdownActions = []string{"shutdown", "restart", "restart-update", "restart-bios", "restart-recovery", "restart-safemode", "restart-boot-entry", "sleep", "hibernate"}
+
+func capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	restrictions := policyRestrictions()
+	if restrictions == nil {
+		restrictions = []policyRestriction{}
+	}
+	updatesReady, err := updatesReadyToInstall()
+	if err != nil {
+		log.Printf("check for staged updates: %v", err)
+	}
+	native, err := nativeArch()
+	if err != nil {
+		log.Printf("detect native architecture: %v", err)
+		native = runtime.GOARCH
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"platform":              runtime.GOOS + "/" + runtime.GOARCH,
+		"nativeArch":            native,
+		"emulated":              native != runtime.GOARCH,
+		"powerControl":          powerControlAvailable,
+		"policyRestrictions":    restrictions,
+		"updatesReadyToInstall": updatesReady,
+		"delays":                delays,
+	})
+}
+
+// checkPolicy answers 403 naming the policy and returns false when a
+// detected restriction applies to action.
+func checkPolicy(w http.ResponseWriter, action string) bool {
+	restriction, restricted := restrictionFor(action)
+	if restricted {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"message": fmt.Sprintf("Blocked by policy %q: %s", restriction.Policy, restriction.Explanation),
+			"error":   "policy_blocked",
+			"policy":  restriction.Policy,
+		})
+	}
+	return !restricted
+}
+
+func restrictionFor(action string) (policyRestriction, bool) {
+	for _, restriction := range policyRestrictions() {
+		for _, restricted := range restriction.Actions {
+			if restricted == action {
+				return restriction, true
+			}
+		}
+	}
+	return policyRestriction{}, false
+}
+
+// lockedActions maps each restricted action to the explanation the page
+// shows as a tooltip on its button.
+func lockedActions() map[string]string {
+	locked := make(map[string]string)
+	for _, restriction := range policyRestrictions() {
+		for _, action := range restriction.Actions {
+			locked[action] = restriction.Policy + ": " + restriction.Explanation
+		}
+	}
+	return locked
+}
+
+func logPolicyRestrictions() {
+	for _, restriction := range policyRestrictions() {
+		log.Printf("policy restriction %q affects %v: %s", restriction.Policy, restriction.Actions, restriction.Explanation)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+func policyRestrictions() []policyRestriction {
+	return nil
+}
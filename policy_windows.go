@@ -0,0 +1,73 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// policyRestrictions inspects the process token for rights that Group
+// Policy can withhold. It is cheap enough to run on every request, so
+// changes applied by gpupdate are picked up without a restart.
+func policyRestrictions() []policyRestriction {
+	var restrictions []policyRestriction
+
+	held, err := holdsPrivilege("SeShutdownPrivilege")
+	if err != nil {
+		log.Printf("check SeShutdownPrivilege: %v", err)
+	} else if !held {
+		restrictions = append(restrictions, policyRestriction{
+			Policy:      "Shut down the system (SeShutdownPrivilege)",
+			Explanation: fmt.Sprintf("the account running WindowsControl (%s) is not granted this user right, so Windows refuses to shut down, restart or suspend. Run it as the service or ask an administrator to assign the right.", currentAccountName()),
+			Actions:     shutdownActions,
+		})
+	}
+	return restrictions
+}
+
+// holdsPrivilege reports whether the process token carries the privilege at
+// all, enabled or not. Rights removed by policy are absent from the token.
+func holdsPrivilege(name string) (bool, error) {
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return false, err
+	}
+	var luid windows.LUID
+	if err := windows.LookupPrivilegeValue(nil, namePtr, &luid); err != nil {
+		return false, err
+	}
+
+	token := windows.GetCurrentProcessToken()
+	var size uint32
+	_ = windows.GetTokenInformation(token, windows.TokenPrivileges, nil, 0, &size)
+	if size == 0 {
+		return false, fmt.Errorf("query token privileges size")
+	}
+	buf := make([]byte, size)
+	if err := windows.GetTokenInformation(token, windows.TokenPrivileges, &buf[0], size, &size); err != nil {
+		return false, err
+	}
+	privileges := (*windows.Tokenprivileges)(unsafe.Pointer(&buf[0]))
+	for _, privilege := range privileges.AllPrivileges() {
+		if privilege.Luid == luid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func currentAccountName() string {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return "unknown"
+	}
+	account, domain, _, err := user.User.Sid.LookupAccount("")
+	if err != nil {
+		return user.User.Sid.String()
+	}
+	return domain + `\` + account
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+)
+
+// powerController stages and cancels shutdowns and restarts. The Windows
+// build calls the shutdown APIs directly; shutdownExeController is kept for
+// the firmware and recovery restarts, which have no documented API, and for
+// stand-ins.
+type powerController interface {
+	Shutdown(req actionRequest) error
+	Restart(req actionRequest) error
+	RestartFirmware(req actionRequest) error
+	// RestartRecovery restarts into the Windows Recovery Environment.
+	RestartRecovery(req actionRequest) error
+	// RestartInstallUpdates installs staged Windows updates and restarts,
+	// like "Update and restart" in the Start menu.
+	RestartInstallUpdates(req actionRequest) error
+	// Abort cancels a pending shutdown or restart, failing with
+	// ERROR_NO_SHUTDOWN_IN_PROGRESS when there is none.
+	Abort() error
+}
+
+// power is the controller the handlers use, chosen once at startup.
+var power = newPowerController()
+
+// shutdownBinEnv names a stand-in for shutdown.exe that records its argv.
+// Setting it routes every power command through shutdownExeController, which
+// lets the HTTP-to-command path be exercised without powering off.
+const shutdownBinEnv = "WINDOWSCONTROL_SHUTDOWN_BIN"
+
+// errRestoreAppsNeedsRestart rejects restoreApps on actions that don't end
+// in a plain restart.
+var errRestoreAppsNeedsRestart = &requestError{status: http.StatusBadRequest, message: "restoreApps is only supported when restarting", code: "invalid_request"}
+
+// shutdownExeController runs shutdown.exe, or a stand-in with the same
+// arguments, at bin.
+type shutdownExeController struct {
+	bin string
+}
+
+func (c shutdownExeController) Shutdown(req actionRequest) error {
+	if req.RestoreApps {
+		return errRestoreAppsNeedsRestart
+	}
+	return c.run(append([]string{"/s", "/t", strconv.Itoa(req.DelaySeconds)}, noteArgs(req)...)...)
+}
+
+// Restart swaps /r for /g when restoreApps is set, which relaunches
+// applications registered with RegisterApplicationRestart.
+func (c shutdownExeController) Restart(req actionRequest) error {
+	mode := "/r"
+	if req.RestoreApps {
+		mode = "/g"
+	}
+	return c.run(append([]string{mode, "/t", strconv.Itoa(req.DelaySeconds)}, noteArgs(req)...)...)
+}
+
+// RestartFirmware uses /fw, which has no /g variant.
+func (c shutdownExeController) RestartFirmware(req actionRequest) error {
+	if req.RestoreApps {
+		return &requestError{status: http.StatusBadRequest, message: "restoreApps cannot be combined with a firmware restart", code: "invalid_request"}
+	}
+	return c.run(append([]string{"/r", "/fw", "/t", strconv.Itoa(req.DelaySeconds)}, noteArgs(req)...)...)
+}
+
+// RestartRecovery uses /o, the advanced boot options menu, which also has no
+// /g variant.
+func (c shutdownExeController) RestartRecovery(req actionRequest) error {
+	if req.RestoreApps {
+		return &requestError{status: http.StatusBadRequest, message: "restoreApps cannot be combined with a recovery restart", code: "invalid_request"}
+	}
+	return c.run(append([]string{"/r", "/o", "/t", strconv.Itoa(req.DelaySeconds)}, noteArgs(req)...)...)
+}
+
+// RestartInstallUpdates can only approximate "Update and restart", since
+// shutdown.exe has no switch that commits staged updates: it restarts with
+// the operating system upgrade reason, unless the client named another,
+// which also lets a stand-in tell it apart from a plain restart.
+func (c shutdownExeController) RestartInstallUpdates(req actionRequest) error {
+	mode := "/r"
+	if req.RestoreApps {
+		mode = "/g"
+	}
+	if req.Reason == "" {
+		req.Reason = "os-upgrade"
+	}
+	return c.run(append([]string{mode, "/t", strconv.Itoa(req.DelaySeconds)}, noteArgs(req)...)...)
+}
+
+func (c shutdownExeController) Abort() error {
+	return c.run("/a")
+}
+
+// noteArgs passes the optional comment and reason as /c and /d. Without
+// them shutdown.exe logs its default planned reason, as before.
+func noteArgs(req actionRequest) []string {
+	var args []string
+	if req.Comment != "" {
+		args = append(args, "/c", req.Comment)
+	}
+	if req.Reason != "" {
+		args = append(args, "/d", shutdownExeReason(req.reasonCode(0)))
+	}
+	return args
+}
+
+func (c shutdownExeController) run(args ...string) error {
+	if err := exec.Command(c.bin, args...).Run(); err != nil {
+		return fmt.Errorf("%s %v: %w", c.bin, args, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func newPowerController() powerController {
+	if bin := os.Getenv(shutdownBinEnv); bin != "" {
+		return shutdownExeController{bin: bin}
+	}
+	return unsupportedPowerController{}
+}
+
+type unsupportedPowerController struct{}
+
+func (unsupportedPowerController) Shutdown(req actionRequest) error {
+	return errors.ErrUnsupported
+}
+
+func (unsupportedPowerController) Restart(req actionRequest) error {
+	return errors.ErrUnsupported
+}
+
+func (unsupportedPowerController) RestartFirmware(req actionRequest) error {
+	return errors.ErrUnsupported
+}
+
+func (unsupportedPowerController) RestartRecovery(req actionRequest) error {
+	return errors.ErrUnsupported
+}
+
+func (unsupportedPowerController) RestartInstallUpdates(req actionRequest) error {
+	return errors.ErrUnsupported
+}
+
+func (unsupportedPowerController) Abort() error {
+	return errors.ErrUnsupported
+}
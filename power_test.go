@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// recordArgvEnv turns the test binary into a stand-in for shutdown.exe that
+// writes its arguments, as JSON, to the named file.
+const recordArgvEnv = "WINDOWSCONTROL_TEST_RECORD_ARGV"
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(recordArgvEnv); path != "" {
+		out, _ := json.Marshal(os.Args[1:])
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePower records the power commands it is asked to run instead of
+// running them.
+type fakePower struct {
+	mu    sync.Mutex
+	calls []string
+	reqs  []actionRequest
+	// errs queues the errors successive calls to a method return; an empty
+	// queue means success.
+	errs map[string][]error
+	// hold, when set, keeps every call running until it is closed.
+	hold chan struct{}
+	// boot is the fake boot configuration installed alongside.
+	boot *fakeBoot
+}
+
+func (f *fakePower) Shutdown(req actionRequest) error        { return f.call("shutdown", req) }
+func (f *fakePower) Restart(req actionRequest) error         { return f.call("restart", req) }
+func (f *fakePower) RestartFirmware(req actionRequest) error { return f.call("restart-firmware", req) }
+func (f *fakePower) RestartRecovery(req actionRequest) error { return f.call("restart-recovery", req) }
+func (f *fakePower) RestartInstallUpdates(req actionRequest) error {
+	return f.call("restart-install-updates", req)
+}
+func (f *fakePower) Abort() error { return f.call("abort", actionRequest{}) }
+
+func (f *fakePower) call(method string, req actionRequest) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	f.reqs = append(f.reqs, req)
+	var err error
+	if queue := f.errs[method]; len(queue) > 0 {
+		f.errs[method] = queue[1:]
+		err = queue[0]
+	}
+	hold := f.hold
+	f.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	return err
+}
+
+// fail makes the next calls to method return errs, in order.
+func (f *fakePower) fail(method string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.errs == nil {
+		f.errs = make(map[string][]error)
+	}
+	f.errs[method] = append(f.errs[method], errs...)
+}
+
+func (f *fakePower) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// useFakePower swaps in a fake controller and boot configuration and
+// pretends the host can run power commands for the rest of the test.
+func useFakePower(t *testing.T) *fakePower {
+	t.Helper()
+	fake := &fakePower{boot: &fakeBoot{}}
+	previous, previousBoot, available := power, boot, powerControlAvailable
+	power, boot, powerControlAvailable = fake, fake.boot, true
+	pendingActions.clear()
+	bitLockerSuspended.Store(false)
+	externalReboot.Store(false)
+	t.Cleanup(func() {
+		power, boot, powerControlAvailable = previous, previousBoot, available
+		pendingActions.clear()
+		bitLockerSuspended.Store(false)
+		externalReboot.Store(false)
+	})
+	return fake
+}
+
+// shutdownArgv runs command against a shutdownExeController whose binary is
+// the recording stand-in and returns the arguments it was started with.
+func shutdownArgv(t *testing.T, command func(shutdownExeController) error) ([]string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "argv.json")
+	t.Setenv(recordArgvEnv, path)
+	if err := command(shutdownExeController{bin: os.Args[0]}); err != nil {
+		return nil, err
+	}
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("the stand-in never ran: %v", err)
+	}
+	var argv []string
+	if err := json.Unmarshal(out, &argv); err != nil {
+		t.Fatal(err)
+	}
+	return argv, nil
+}
+
+func TestShutdownExeArgv(t *testing.T) {
+	tests := []struct {
+		name    string
+		command func(shutdownExeController) error
+		want    []string
+	}{
+		{"shutdown", func(c shutdownExeController) error { return c.Shutdown(actionRequest{}) }, []string{"/s", "/t", "0"}},
+		{"delayed shutdown", func(c shutdownExeController) error { return c.Shutdown(actionRequest{DelaySeconds: 300}) }, []string{"/s", "/t", "300"}},
+		{"restart", func(c shutdownExeController) error { return c.Restart(actionRequest{DelaySeconds: 60}) }, []string{"/r", "/t", "60"}},
+		{"restart restoring apps", func(c shutdownExeController) error { return c.Restart(actionRequest{RestoreApps: true}) }, []string{"/g", "/t", "0"}},
+		{"firmware restart", func(c shutdownExeController) error { return c.RestartFirmware(actionRequest{}) }, []string{"/r", "/fw", "/t", "0"}},
+		{"recovery restart", func(c shutdownExeController) error { return c.RestartRecovery(actionRequest{DelaySeconds: 5}) }, []string{"/r", "/o", "/t", "5"}},
+		{"update and restart", func(c shutdownExeController) error { return c.RestartInstallUpdates(actionRequest{DelaySeconds: 60}) }, []string{"/r", "/t", "60", "/d", "p:2:3"}},
+		{"update and restart with a reason", func(c shutdownExeController) error {
+			return c.RestartInstallUpdates(actionRequest{Reason: "maintenance"})
+		}, []string{"/r", "/t", "0", "/d", "p:1:1"}},
+		{"abort", func(c shutdownExeController) error { return c.Abort() }, []string{"/a"}},
+		{
+			"comment and reason",
+			func(c shutdownExeController) error {
+				return c.Shutdown(actionRequest{Comment: "Patching tonight", Reason: "maintenance"})
+			},
+			[]string{"/s", "/t", "0", "/c", "Patching tonight", "/d", "p:1:1"},
+		},
+		{
+			"restart with comment",
+			func(c shutdownExeController) error { return c.Restart(actionRequest{Comment: "back soon"}) },
+			[]string{"/r", "/t", "0", "/c", "back soon"},
+		},
+		{
+			"unplanned reason",
+			func(c shutdownExeController) error { return c.Restart(actionRequest{Reason: "unplanned"}) },
+			[]string{"/r", "/t", "0", "/d", "u:0:0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := shutdownArgv(t, tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(argv, tt.want) {
+				t.Errorf("argv = %q, want %q", argv, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientCommandError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.Errno(1722), true},
+		{syscall.Errno(1723), true},
+		{syscall.Errno(1726), true},
+		{fmt.Errorf("shutdown.exe: %w", syscall.Errno(1722)), true},
+		{syscall.Errno(5), false},
+		{syscall.Errno(errShutdownIsScheduled), false},
+		{errors.New("no code"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isTransientCommandError(tt.err); got != tt.want {
+			t.Errorf("isTransientCommandError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPowerCommandRetry(t *testing.T) {
+	fake := useFakePower(t)
+	fake.fail("restart", syscall.Errno(1726))
+	rec := serve(t, http.MethodPost, "/restart", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%d %s, want 200 after a retry", rec.Code, rec.Body)
+	}
+	if got := decodeBody(t, rec)["attempts"]; got != float64(2) {
+		t.Errorf("attempts = %v, want 2", got)
+	}
+	if calls := fake.called(); !slices.Equal(calls, []string{"restart", "restart"}) {
+		t.Errorf("calls = %v, want two restarts", calls)
+	}
+}
+
+func TestPowerCommandPermanentFailure(t *testing.T) {
+	fake := useFakePower(t)
+	fake.fail("shutdown", syscall.Errno(5))
+	rec := serve(t, http.MethodPost, "/shutdown", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("%d %s, want 500", rec.Code, rec.Body)
+	}
+	payload := decodeBody(t, rec)
+	if payload["error"] != "exec_failed" || payload["errorCode"] != float64(5) || payload["attempts"] != float64(1) {
+		t.Errorf("payload = %v, want exec_failed with errorCode 5 after one attempt", payload)
+	}
+	if calls := fake.called(); len(calls) != 1 {
+		t.Errorf("a permanent failure was retried: %v", calls)
+	}
+}
+
+func TestExternalShutdownPending(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		abortErr     error
+		want         int
+		wantCalls    []string
+		wantError    string
+		wantExternal bool
+	}{
+		{"refused without override", "", nil, http.StatusConflict, []string{"shutdown"}, "external_reboot_pending", true},
+		{"override cancels and retries", `{"override": true}`, nil, http.StatusOK, []string{"shutdown", "abort", "shutdown"}, "", false},
+		{"override fails to cancel", `{"override": true}`, syscall.Errno(5), http.StatusInternalServerError, []string{"shutdown", "abort"}, "exec_failed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakePower(t)
+			fake.fail("shutdown", syscall.Errno(errShutdownIsScheduled))
+			if tt.abortErr != nil {
+				fake.fail("abort", tt.abortErr)
+			}
+			rec := serve(t, http.MethodPost, "/shutdown", tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("%d %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+			if calls := fake.called(); !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if tt.wantError != "" {
+				if got := decodeBody(t, rec)["error"]; got != tt.wantError {
+					t.Errorf("error = %v, want %s", got, tt.wantError)
+				}
+			}
+			// /status and the events snapshot report what the attempt saw.
+			if got := decodeBody(t, serve(t, http.MethodGet, "/status", ""))["externalRebootPending"]; got != tt.wantExternal {
+				t.Errorf("/status externalRebootPending = %v, want %v", got, tt.wantExternal)
+			}
+			if got := statusEvent().ExternalRebootPending; got != tt.wantExternal {
+				t.Errorf("status event externalRebootPending = %v, want %v", got, tt.wantExternal)
+			}
+		})
+	}
+}
+
+func TestShutdownExeRestoreApps(t *testing.T) {
+	tests := []struct {
+		name    string
+		command func(shutdownExeController) error
+		want    []string
+	}{
+		{"restart relaunches apps with /g", func(c shutdownExeController) error {
+			return c.Restart(actionRequest{RestoreApps: true, DelaySeconds: 30})
+		}, []string{"/g", "/t", "30"}},
+		{"restart without restoreApps keeps /r", func(c shutdownExeController) error {
+			return c.Restart(actionRequest{DelaySeconds: 30})
+		}, []string{"/r", "/t", "30"}},
+		{"shutdown refuses restoreApps", func(c shutdownExeController) error {
+			return c.Shutdown(actionRequest{RestoreApps: true})
+		}, nil},
+		{"firmware restart refuses restoreApps", func(c shutdownExeController) error {
+			return c.RestartFirmware(actionRequest{RestoreApps: true})
+		}, nil},
+		{"recovery restart refuses restoreApps", func(c shutdownExeController) error {
+			return c.RestartRecovery(actionRequest{RestoreApps: true})
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := shutdownArgv(t, tt.command)
+			if tt.want == nil {
+				var rejected *requestError
+				if !errors.As(err, &rejected) || rejected.status != http.StatusBadRequest {
+					t.Fatalf("err = %v, want a 400 request error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(argv, tt.want) {
+				t.Errorf("argv = %q, want %q", argv, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnPendingShutdownIsNamed(t *testing.T) {
+	fake := useFakePower(t)
+	if rec := serve(t, http.MethodPost, "/restart", `{"delaySeconds": 600}`); rec.Code != http.StatusOK {
+		t.Fatalf("restart: %d %s", rec.Code, rec.Body)
+	}
+	fake.fail("shutdown", syscall.Errno(errShutdownIsScheduled))
+	rec := serve(t, http.MethodPost, "/shutdown", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("shutdown: %d %s, want 409", rec.Code, rec.Body)
+	}
+	payload := decodeBody(t, rec)
+	if payload["pendingAction"] != "restart" {
+		t.Errorf("pendingAction = %v, want restart", payload["pendingAction"])
+	}
+	message, _ := payload["message"].(string)
+	if strings.Contains(message, "Windows Update") || !strings.Contains(message, "restart") {
+		t.Errorf("message %q should name this server's pending restart", message)
+	}
+}
@@ -0,0 +1,129 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// InitiateShutdown flags and reasons, from winuser.h / reason.h.
+	shutdownForceOthers    = 0x00000001
+	shutdownRestart        = 0x00000004
+	shutdownPoweroff       = 0x00000008
+	shutdownInstallUpdates = 0x00000040
+	shutdownRestartApps    = 0x00000080
+	shutdownReasonPlanned  = 0x80000000 // SHTDN_REASON_FLAG_PLANNED | MAJOR_OTHER, as shutdown.exe without /d
+	shutdownReasonUpdate   = 0x80020003 // SHTDN_REASON_FLAG_PLANNED | MAJOR_OPERATINGSYSTEM | MINOR_UPGRADE
+)
+
+var (
+	modadvapi32              = windows.NewLazySystemDLL("advapi32.dll")
+	procInitiateShutdownW    = modadvapi32.NewProc("InitiateShutdownW")
+	procAbortSystemShutdownW = modadvapi32.NewProc("AbortSystemShutdownW")
+)
+
+func newPowerController() powerController {
+	if bin := os.Getenv(shutdownBinEnv); bin != "" {
+		return shutdownExeController{bin: bin}
+	}
+	return win32PowerController{}
+}
+
+// win32PowerController calls InitiateShutdownW, so failures carry the real
+// Win32 error instead of shutdown.exe's exit code.
+type win32PowerController struct{}
+
+func (win32PowerController) Shutdown(req actionRequest) error {
+	if req.RestoreApps {
+		return errRestoreAppsNeedsRestart
+	}
+	return initiateShutdown(req, shutdownPoweroff, req.reasonCode(shutdownReasonPlanned))
+}
+
+func (win32PowerController) Restart(req actionRequest) error {
+	flags := uint32(shutdownRestart)
+	if req.RestoreApps {
+		flags |= shutdownRestartApps
+	}
+	return initiateShutdown(req, flags, req.reasonCode(shutdownReasonPlanned))
+}
+
+// RestartInstallUpdates is the API equivalent of "Update and restart":
+// shutdown.exe has no switch for committing staged updates.
+func (win32PowerController) RestartInstallUpdates(req actionRequest) error {
+	flags := uint32(shutdownRestart | shutdownInstallUpdates)
+	if req.RestoreApps {
+		flags |= shutdownRestartApps
+	}
+	return initiateShutdown(req, flags, req.reasonCode(shutdownReasonUpdate))
+}
+
+// RestartFirmware still runs shutdown.exe /fw: booting into firmware setup
+// has no documented API.
+func (win32PowerController) RestartFirmware(req actionRequest) error {
+	exe, err := systemShutdownExe()
+	if err != nil {
+		return err
+	}
+	return exe.RestartFirmware(req)
+}
+
+// RestartRecovery runs shutdown.exe /o for the same reason.
+func (win32PowerController) RestartRecovery(req actionRequest) error {
+	exe, err := systemShutdownExe()
+	if err != nil {
+		return err
+	}
+	return exe.RestartRecovery(req)
+}
+
+// systemShutdownExe is shutdown.exe by its full path, which avoids depending
+// on PATH, minimal for services.
+func systemShutdownExe() (shutdownExeController, error) {
+	system, err := windows.GetSystemDirectory()
+	if err != nil {
+		return shutdownExeController{}, err
+	}
+	return shutdownExeController{bin: filepath.Join(system, "shutdown.exe")}, nil
+}
+
+func (win32PowerController) Abort() error {
+	if err := enablePrivilege("SeShutdownPrivilege"); err != nil {
+		return err
+	}
+	if ret, _, err := procAbortSystemShutdownW.Call(0); ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// initiateShutdown stages a shutdown of the local machine after the request's
+// delay, showing its comment to signed-in users. Like shutdown.exe, a
+// non-zero delay implies forcing other applications closed, so an unsaved
+// document can't hold the machine up indefinitely.
+func initiateShutdown(req actionRequest, flags, reason uint32) error {
+	if err := enablePrivilege("SeShutdownPrivilege"); err != nil {
+		return err
+	}
+	if req.DelaySeconds > 0 {
+		flags |= shutdownForceOthers
+	}
+	var message *uint16
+	if req.Comment != "" {
+		var err error
+		if message, err = windows.UTF16PtrFromString(req.Comment); err != nil {
+			return err
+		}
+	}
+	ret, _, _ := procInitiateShutdownW.Call(0, uintptr(unsafe.Pointer(message)), uintptr(req.DelaySeconds), uintptr(flags), uintptr(reason))
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
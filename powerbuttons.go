@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+)
+
+// buttonActionNames are the POWERBUTTON_ACTION_INDEX values by name.
+// turnOffDisplay only exists for the power button.
+var buttonActionNames = []string{"doNothing", "sleep", "hibernate", "shutdown", "turnOffDisplay"}
+
+type buttonActions struct {
+	PowerButton string `json:"powerButton,omitempty"`
+	LidClose    string `json:"lidClose,omitempty"`
+}
+
+type buttonSettings struct {
+	AC buttonActions `json:"ac"`
+	DC buttonActions `json:"dc"`
+}
+
+func powerButtonsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if runtime.GOOS != "windows" {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"message": "Power button configuration is available only on Windows hosts.",
+		})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var update buttonSettings
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": fmt.Sprintf("invalid request body: %v", err),
+			})
+			return
+		}
+		if err := validateButtonSettings(update); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+			return
+		}
+		if err := writeButtonSettings(update); err != nil {
+			log.Printf("write power button settings: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{
+				"message": "Failed to update the power button settings.",
+			})
+			return
+		}
+		log.Printf("power button settings updated: %+v", update)
+	}
+
+	settings, err := readButtonSettings()
+	if err != nil {
+		log.Printf("read power button settings: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to read the power button settings.",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func validateButtonSettings(settings buttonSettings) error {
+	for _, actions := range []buttonActions{settings.AC, settings.DC} {
+		if actions.PowerButton != "" {
+			if _, err := buttonActionIndex(actions.PowerButton); err != nil {
+				return err
+			}
+		}
+		if actions.LidClose != "" {
+			index, err := buttonActionIndex(actions.LidClose)
+			if err != nil {
+				return err
+			}
+			if buttonActionNames[index] == "turnOffDisplay" {
+				return fmt.Errorf("lidClose does not support %q", actions.LidClose)
+			}
+		}
+	}
+	return nil
+}
+
+func buttonActionIndex(name string) (uint32, error) {
+	for i, candidate := range buttonActionNames {
+		if candidate == name {
+			return uint32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown button action %q; use one of %v", name, buttonActionNames)
+}
+
+func buttonActionName(index uint32) string {
+	if int(index) < len(buttonActionNames) {
+		return buttonActionNames[index]
+	}
+	return fmt.Sprintf("unknown(%d)", index)
+}
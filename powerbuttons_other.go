@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func readButtonSettings() (buttonSettings, error) {
+	return buttonSettings{}, errors.ErrUnsupported
+}
+
+func writeButtonSettings(settings buttonSettings) error {
+	return errors.ErrUnsupported
+}
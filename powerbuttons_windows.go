@@ -0,0 +1,110 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	// GUID_SYSTEM_BUTTON_SUBGROUP and the settings within it.
+	buttonSubgroup     = windows.GUID{Data1: 0x4f971e89, Data2: 0xeebd, Data3: 0x4455, Data4: [8]byte{0xa8, 0xde, 0x9e, 0x59, 0x04, 0x0e, 0x73, 0x47}}
+	powerButtonSetting = windows.GUID{Data1: 0x7648efa3, Data2: 0xdd9c, Data3: 0x4e3e, Data4: [8]byte{0xb5, 0x66, 0x50, 0xf9, 0x29, 0x38, 0x62, 0x80}}
+	lidCloseSetting    = windows.GUID{Data1: 0x5ca83367, Data2: 0x6e45, Data3: 0x459f, Data4: [8]byte{0xa2, 0x7b, 0x47, 0x6b, 0x1d, 0x01, 0xc9, 0x36}}
+)
+
+var (
+	modpowrprof                = windows.NewLazySystemDLL("powrprof.dll")
+	procPowerGetActiveScheme   = modpowrprof.NewProc("PowerGetActiveScheme")
+	procPowerSetActiveScheme   = modpowrprof.NewProc("PowerSetActiveScheme")
+	procPowerReadACValueIndex  = modpowrprof.NewProc("PowerReadACValueIndex")
+	procPowerReadDCValueIndex  = modpowrprof.NewProc("PowerReadDCValueIndex")
+	procPowerWriteACValueIndex = modpowrprof.NewProc("PowerWriteACValueIndex")
+	procPowerWriteDCValueIndex = modpowrprof.NewProc("PowerWriteDCValueIndex")
+)
+
+func readButtonSettings() (buttonSettings, error) {
+	scheme, err := activePowerScheme()
+	if err != nil {
+		return buttonSettings{}, err
+	}
+
+	var settings buttonSettings
+	reads := []struct {
+		proc    *windows.LazyProc
+		setting *windows.GUID
+		dest    *string
+	}{
+		{procPowerReadACValueIndex, &powerButtonSetting, &settings.AC.PowerButton},
+		{procPowerReadACValueIndex, &lidCloseSetting, &settings.AC.LidClose},
+		{procPowerReadDCValueIndex, &powerButtonSetting, &settings.DC.PowerButton},
+		{procPowerReadDCValueIndex, &lidCloseSetting, &settings.DC.LidClose},
+	}
+	for _, read := range reads {
+		var value uint32
+		ret, _, _ := read.proc.Call(0,
+			uintptr(unsafe.Pointer(&scheme)),
+			uintptr(unsafe.Pointer(&buttonSubgroup)),
+			uintptr(unsafe.Pointer(read.setting)),
+			uintptr(unsafe.Pointer(&value)))
+		if ret != 0 {
+			return buttonSettings{}, syscall.Errno(ret)
+		}
+		*read.dest = buttonActionName(value)
+	}
+	return settings, nil
+}
+
+// writeButtonSettings stores the non-empty fields in the active scheme and
+// re-applies it, the API equivalent of powercfg -setactive.
+func writeButtonSettings(settings buttonSettings) error {
+	scheme, err := activePowerScheme()
+	if err != nil {
+		return err
+	}
+
+	writes := []struct {
+		proc    *windows.LazyProc
+		setting *windows.GUID
+		name    string
+	}{
+		{procPowerWriteACValueIndex, &powerButtonSetting, settings.AC.PowerButton},
+		{procPowerWriteACValueIndex, &lidCloseSetting, settings.AC.LidClose},
+		{procPowerWriteDCValueIndex, &powerButtonSetting, settings.DC.PowerButton},
+		{procPowerWriteDCValueIndex, &lidCloseSetting, settings.DC.LidClose},
+	}
+	for _, write := range writes {
+		if write.name == "" {
+			continue
+		}
+		index, err := buttonActionIndex(write.name)
+		if err != nil {
+			return err
+		}
+		ret, _, _ := write.proc.Call(0,
+			uintptr(unsafe.Pointer(&scheme)),
+			uintptr(unsafe.Pointer(&buttonSubgroup)),
+			uintptr(unsafe.Pointer(write.setting)),
+			uintptr(index))
+		if ret != 0 {
+			return syscall.Errno(ret)
+		}
+	}
+
+	if ret, _, _ := procPowerSetActiveScheme.Call(0, uintptr(unsafe.Pointer(&scheme))); ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+func activePowerScheme() (windows.GUID, error) {
+	var scheme *windows.GUID
+	if ret, _, _ := procPowerGetActiveScheme.Call(0, uintptr(unsafe.Pointer(&scheme))); ret != 0 {
+		return windows.GUID{}, syscall.Errno(ret)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(scheme)))
+	return *scheme, nil
+}
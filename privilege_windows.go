@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// enablePrivilege turns on a privilege the process token already holds but
+// has disabled, such as SeSystemEnvironmentPrivilege for an elevated admin.
+// AdjustTokenPrivileges succeeds even when the privilege isn't held at all;
+// that case surfaces as ERROR_PRIVILEGE_NOT_HELD from the call that needs it.
+func enablePrivilege(name string) error {
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token); err != nil {
+		return err
+	}
+	defer token.Close()
+
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	privileges := windows.Tokenprivileges{PrivilegeCount: 1}
+	if err := windows.LookupPrivilegeValue(nil, namePtr, &privileges.Privileges[0].Luid); err != nil {
+		return err
+	}
+	privileges.Privileges[0].Attributes = windows.SE_PRIVILEGE_ENABLED
+	return windows.AdjustTokenPrivileges(token, false, &privileges, uint32(unsafe.Sizeof(privileges)), nil, nil)
+}
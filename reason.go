@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maxCommentLength is MAX_REASON_COMMENT_LEN, the longest message
+// InitiateShutdown and shutdown /c accept, in UTF-16 code units.
+const maxCommentLength = 512
+
+// shutdownReasons maps the reason names clients may send to SHTDN_REASON
+// codes, which the shutdown event tracker records.
+var shutdownReasons = map[string]uint32{
+	"planned":     0x80000000, // FLAG_PLANNED | MAJOR_OTHER | MINOR_OTHER
+	"unplanned":   0x00000000, // MAJOR_OTHER | MINOR_OTHER
+	"maintenance": 0x80010001, // FLAG_PLANNED | MAJOR_HARDWARE | MINOR_MAINTENANCE
+	"application": 0x80040001, // FLAG_PLANNED | MAJOR_APPLICATION | MINOR_MAINTENANCE
+	"os-upgrade":  0x80020003, // FLAG_PLANNED | MAJOR_OPERATINGSYSTEM | MINOR_UPGRADE
+}
+
+// errReasonNeedsShutdown rejects comment and reason on actions that don't
+// go through the shutdown APIs.
+var errReasonNeedsShutdown = &requestError{status: http.StatusBadRequest, message: "comment and reason are only supported when shutting down or restarting", code: "invalid_request"}
+
+// validateShutdownNote checks the optional comment and reason. Control
+// characters are refused outright, since the comment ends up on
+// shutdown.exe's command line and in a notification.
+func validateShutdownNote(req actionRequest) error {
+	if len(utf16.Encode([]rune(req.Comment))) > maxCommentLength {
+		return &requestError{status: http.StatusBadRequest, message: fmt.Sprintf("comment must be at most %d characters", maxCommentLength), code: "invalid_request"}
+	}
+	if strings.IndexFunc(req.Comment, unicode.IsControl) >= 0 {
+		return &requestError{status: http.StatusBadRequest, message: "comment must not contain control characters", code: "invalid_request"}
+	}
+	if _, ok := shutdownReasons[req.Reason]; req.Reason != "" && !ok {
+		names := slices.Sorted(maps.Keys(shutdownReasons))
+		return &requestError{status: http.StatusBadRequest, message: fmt.Sprintf("unknown reason %q; use one of %s", req.Reason, strings.Join(names, ", ")), code: "invalid_request"}
+	}
+	return nil
+}
+
+// reasonCode is the SHTDN_REASON code for req, or fallback when the client
+// didn't name one.
+func (req actionRequest) reasonCode(fallback uint32) uint32 {
+	if code, ok := shutdownReasons[req.Reason]; ok {
+		return code
+	}
+	return fallback
+}
+
+// shutdownExeReason formats code for shutdown /d, e.g. "p:4:1".
+func shutdownExeReason(code uint32) string {
+	kind := "u"
+	if code&0x80000000 != 0 {
+		kind = "p"
+	}
+	return fmt.Sprintf("%s:%d:%d", kind, code>>16&0xff, code&0xffff)
+}
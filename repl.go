@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replActions maps console commands to the endpoints that implement them.
+// Commands are replayed through the HTTP handlers so the console gets the
+// same validation, policy checks and command guard as the web UI.
+var replActions = map[string]string{
+	"shutdown":         "/shutdown",
+	"restart":          "/restart",
+	"restart-bios":     "/restart-bios",
+	"restart-recovery": "/restart-recovery",
+	"restart-safemode": "/restart-safemode",
+	"update":           "/restart-update",
+	"sleep":            "/sleep",
+	"hibernate":        "/hibernate",
+	"lock":             "/lock",
+	"logoff":           "/logoff",
+}
+
+const replHelp = `Commands:
+  shutdown [delay]          power off, e.g. "shutdown 10m"
+  restart [delay]           restart, e.g. "restart 90s"
+  restart-bios [delay]      restart into firmware setup
+  restart-recovery [delay]  restart into the Windows Recovery Environment
+  restart-safemode [delay]  restart into safe mode
+  update [delay]            install staged Windows updates and restart
+  sleep [delay]             put the machine to sleep
+  hibernate [delay]         hibernate the machine
+  lock [delay]              lock the console session
+  logoff [delay]            sign out the console user
+  help                      show this list
+  quit                      stop the server
+Delays are Go durations (30s, 10m, 1h30m), plain seconds, or a local
+time such as 23:30 for its next occurrence.
+`
+
+// runREPL reads commands from in until it is exhausted, ctx is done, or the
+// user quits, in which case quit is called to stop the server.
+func runREPL(ctx context.Context, handler http.Handler, in io.Reader, out io.Writer, quit func()) {
+	fmt.Fprint(out, "Console commands enabled; type \"help\" for a list.\n")
+	scanner := bufio.NewScanner(in)
+	for ctx.Err() == nil && scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch cmd := strings.ToLower(fields[0]); cmd {
+		case "help", "?":
+			fmt.Fprint(out, replHelp)
+		case "quit", "exit":
+			quit()
+			return
+		default:
+			endpoint, ok := replActions[cmd]
+			if !ok {
+				fmt.Fprintf(out, "unknown command %q; type \"help\" for a list\n", cmd)
+				continue
+			}
+			if len(fields) > 2 {
+				fmt.Fprintf(out, "usage: %s [delay]\n", cmd)
+				continue
+			}
+			var payload actionRequest
+			if len(fields) == 2 {
+				if strings.Contains(fields[1], ":") {
+					payload.At = fields[1]
+				} else {
+					parsed, err := parseREPLDelay(fields[1])
+					if err != nil {
+						fmt.Fprintln(out, err)
+						continue
+					}
+					payload.DelaySeconds = parsed
+				}
+			}
+			runREPLAction(handler, out, endpoint, payload)
+		}
+	}
+}
+
+func runREPLAction(handler http.Handler, out io.Writer, endpoint string, payload actionRequest) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Identifies the console in /events and the audit log.
+	req.RemoteAddr = "console"
+	rec := &replResponse{}
+	handler.ServeHTTP(rec, req)
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+
+	// Typing the command is already deliberate, so an action armed by
+	// confirmActions is confirmed straight away.
+	if rec.code == http.StatusAccepted && payload.ConfirmToken == "" {
+		var armed struct {
+			ConfirmToken string `json:"confirmToken"`
+		}
+		if json.Unmarshal(rec.body.Bytes(), &armed) == nil && armed.ConfirmToken != "" {
+			payload.ConfirmToken = armed.ConfirmToken
+			runREPLAction(handler, out, endpoint, payload)
+			return
+		}
+	}
+
+	fmt.Fprintf(out, "%d %s\n", rec.code, http.StatusText(rec.code))
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, rec.body.Bytes(), "", "  "); err != nil {
+		out.Write(rec.body.Bytes())
+		return
+	}
+	pretty.WriteTo(out)
+}
+
+// replResponse collects the response to a console command.
+type replResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *replResponse) Header() http.Header {
+	if r.header == nil {
+		r.header = make(http.Header)
+	}
+	return r.header
+}
+
+func (r *replResponse) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *replResponse) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func parseREPLDelay(value string) (int, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds, nil
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay %q: use a duration like 10m or a number of seconds", value)
+	}
+	return int(delay.Round(time.Second) / time.Second), nil
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestREPLRunsActionsThroughTheMux(t *testing.T) {
+	fake := useFakePower(t)
+	requireConfirmation = true
+	t.Cleanup(func() { requireConfirmation = false })
+
+	var out strings.Builder
+	in := strings.NewReader("restart 90s\nbogus\nquit\n")
+	quit := false
+	runREPL(context.Background(), newMux(), in, &out, func() { quit = true })
+
+	if calls := fake.called(); len(calls) != 1 || calls[0] != "restart" {
+		t.Fatalf("calls = %v, want [restart]", calls)
+	}
+	if delay := fake.reqs[0].DelaySeconds; delay != 90 {
+		t.Errorf("delaySeconds = %d, want 90", delay)
+	}
+	for _, want := range []string{"200 OK", `"action": "restart"`, `unknown command "bogus"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q lacks %q", out.String(), want)
+		}
+	}
+	if !quit {
+		t.Error("quit was not called")
+	}
+}
+
+func TestParseREPLDelay(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"30", 30, true},
+		{"90s", 90, true},
+		{"1h30m", 5400, true},
+		{"1500ms", 2, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseREPLDelay(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseREPLDelay(%q) = %d, %v", tt.value, got, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// lockingProcess is an application Restart Manager reports as holding a
+// file that is waiting to be replaced at the next reboot.
+type lockingProcess struct {
+	PID         uint32 `json:"pid"`
+	Name        string `json:"name"`
+	Service     string `json:"service,omitempty"`
+	Type        string `json:"type"`
+	Restartable bool   `json:"restartable"`
+}
+
+type restartManagerReport struct {
+	PendingFiles int              `json:"pendingFiles"`
+	Processes    []lockingProcess `json:"processes"`
+}
+
+func restartManagerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if runtime.GOOS != "windows" {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"message": "Restart Manager reporting is available only on Windows hosts.",
+		})
+		return
+	}
+
+	report, err := pendingFileLocks()
+	if err != nil {
+		log.Printf("query Restart Manager: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to query Restart Manager.",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// rmAppType names the RM_APP_TYPE values.
+func rmAppType(kind uint32) string {
+	switch kind {
+	case 1, 2:
+		return "window"
+	case 3:
+		return "service"
+	case 4:
+		return "explorer"
+	case 5:
+		return "console"
+	case 1000:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// pendingRenameTargets extracts the files a PendingFileRenameOperations
+// value will replace or delete. Entries come in source/destination pairs;
+// the destination is the file in place today, or empty when the source is
+// to be deleted. Paths carry the \??\ NT prefix, which Restart Manager
+// doesn't accept.
+func pendingRenameTargets(operations []string) []string {
+	var targets []string
+	for i := 0; i+1 < len(operations); i += 2 {
+		target := operations[i+1]
+		if target == "" {
+			target = operations[i]
+		}
+		target = strings.TrimPrefix(strings.TrimPrefix(target, "!"), `\??\`)
+		if target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func pendingFileLocks() (restartManagerReport, error) {
+	return restartManagerReport{}, errors.ErrUnsupported
+}
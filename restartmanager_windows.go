@@ -0,0 +1,107 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	modrstrtmgr             = windows.NewLazySystemDLL("rstrtmgr.dll")
+	procRmStartSession      = modrstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources = modrstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList           = modrstrtmgr.NewProc("RmGetList")
+	procRmEndSession        = modrstrtmgr.NewProc("RmEndSession")
+)
+
+// rmProcessInfo mirrors RM_PROCESS_INFO.
+type rmProcessInfo struct {
+	ProcessID        uint32
+	ProcessStartTime windows.Filetime
+	AppName          [256]uint16 // CCH_RM_MAX_APP_NAME + 1
+	ServiceShortName [64]uint16  // CCH_RM_MAX_SVC_NAME + 1
+	ApplicationType  uint32
+	AppStatus        uint32
+	TSSessionID      uint32
+	Restartable      int32
+}
+
+// pendingFileLocks registers the files queued in PendingFileRenameOperations
+// with a Restart Manager session and lists the processes holding them.
+func pendingFileLocks() (restartManagerReport, error) {
+	report := restartManagerReport{Processes: []lockingProcess{}}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager`, registry.QUERY_VALUE)
+	if err != nil {
+		return report, err
+	}
+	operations, _, err := key.GetStringsValue("PendingFileRenameOperations")
+	key.Close()
+	if errors.Is(err, registry.ErrNotExist) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	files := pendingRenameTargets(operations)
+	report.PendingFiles = len(files)
+	if len(files) == 0 {
+		return report, nil
+	}
+
+	var session uint32
+	var sessionKey [33]uint16 // CCH_RM_SESSION_KEY + 1
+	if ret, _, _ := procRmStartSession.Call(uintptr(unsafe.Pointer(&session)), 0, uintptr(unsafe.Pointer(&sessionKey[0]))); ret != 0 {
+		return report, syscall.Errno(ret)
+	}
+	defer procRmEndSession.Call(uintptr(session))
+
+	names := make([]*uint16, 0, len(files))
+	for _, file := range files {
+		name, err := windows.UTF16PtrFromString(file)
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	if ret, _, _ := procRmRegisterResources.Call(uintptr(session), uintptr(len(names)), uintptr(unsafe.Pointer(&names[0])), 0, 0, 0, 0); ret != 0 {
+		return report, syscall.Errno(ret)
+	}
+
+	// The list can grow between the sizing call and the real one, so retry
+	// while RmGetList still reports ERROR_MORE_DATA.
+	var infos []rmProcessInfo
+	for {
+		var needed, count, reasons uint32
+		count = uint32(len(infos))
+		var buf uintptr
+		if count > 0 {
+			buf = uintptr(unsafe.Pointer(&infos[0]))
+		}
+		ret, _, _ := procRmGetList.Call(uintptr(session), uintptr(unsafe.Pointer(&needed)), uintptr(unsafe.Pointer(&count)), buf, uintptr(unsafe.Pointer(&reasons)))
+		if syscall.Errno(ret) == windows.ERROR_MORE_DATA {
+			infos = make([]rmProcessInfo, needed)
+			continue
+		}
+		if ret != 0 {
+			return report, syscall.Errno(ret)
+		}
+		infos = infos[:count]
+		break
+	}
+
+	for _, info := range infos {
+		report.Processes = append(report.Processes, lockingProcess{
+			PID:         info.ProcessID,
+			Name:        windows.UTF16ToString(info.AppName[:]),
+			Service:     windows.UTF16ToString(info.ServiceShortName[:]),
+			Type:        rmAppType(info.ApplicationType),
+			Restartable: info.Restartable != 0,
+		})
+	}
+	return report, nil
+}
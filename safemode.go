@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// safeModeRestart arms the safeboot flag and restarts. The flag is cleared
+// again if the restart can't be staged, so a later, ordinary reboot doesn't
+// land in safe mode.
+func safeModeRestart(req actionRequest) error {
+	if req.RestoreApps {
+		return &requestError{status: http.StatusBadRequest, message: "restoreApps cannot be combined with a safe mode restart", code: "invalid_request"}
+	}
+	if err := boot.ArmSafeBoot(req.Network); err != nil {
+		log.Printf("arm safe mode boot: %v", err)
+		return &requestError{status: http.StatusInternalServerError, message: "Failed to set the safe mode boot flag; restart aborted.", code: "exec_failed"}
+	}
+	if err := power.Restart(req); err != nil {
+		if clearErr := boot.ClearSafeBoot(); clearErr != nil {
+			log.Printf("clear safe mode boot flag after failed restart: %v", clearErr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func armSafeBoot(network bool) error {
+	return errors.ErrUnsupported
+}
+
+func clearSafeBoot() error {
+	return nil
+}
@@ -0,0 +1,94 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// safeBootCleanupTask names the scheduled task that clears the flag.
+const safeBootCleanupTask = "WindowsControlClearSafeBoot"
+
+// armSafeBoot sets {current} to boot into safe mode, with networking when
+// asked, and registers a scheduled task that clears the flag at the next
+// boot. The task runs as SYSTEM when the machine starts, so nobody has to
+// sign in at the console, and deletes itself once it has run. If the task
+// can't be registered the flag is cleared again, since nothing else would
+// ever take the machine out of safe mode.
+func armSafeBoot(network bool) error {
+	mode := "minimal"
+	if network {
+		mode = "network"
+	}
+	system, err := windows.GetSystemDirectory()
+	if err != nil {
+		return err
+	}
+	if err := runSystemTool(system, "bcdedit.exe", "/set", "{current}", "safeboot", mode); err != nil {
+		return err
+	}
+	cleanup := fmt.Sprintf(`%s /c %s /deletevalue {current} safeboot & %s /delete /tn %s /f`,
+		filepath.Join(system, "cmd.exe"), filepath.Join(system, "bcdedit.exe"), filepath.Join(system, "schtasks.exe"), safeBootCleanupTask)
+	err = runSystemTool(system, "schtasks.exe", "/create", "/tn", safeBootCleanupTask, "/sc", "onstart", "/ru", "SYSTEM", "/rl", "highest", "/f", "/tr", cleanup)
+	if err != nil {
+		if clearErr := clearSafeBoot(); clearErr != nil {
+			log.Printf("clear safe mode boot flag: %v", clearErr)
+		}
+		return fmt.Errorf("register safe mode cleanup: %w", err)
+	}
+	return nil
+}
+
+// clearSafeBoot removes the safeboot flag and the cleanup task when they
+// are present, treating either being absent as success.
+func clearSafeBoot() error {
+	system, err := windows.GetSystemDirectory()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if safeBootIsSet(system) {
+		if err := runSystemTool(system, "bcdedit.exe", "/deletevalue", "{current}", "safeboot"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// schtasks /query fails for a task that doesn't exist.
+	if exec.Command(filepath.Join(system, "schtasks.exe"), "/query", "/tn", safeBootCleanupTask).Run() == nil {
+		if err := runSystemTool(system, "schtasks.exe", "/delete", "/tn", safeBootCleanupTask, "/f"); err != nil {
+			errs = append(errs, fmt.Errorf("remove safe mode cleanup: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// safeBootIsSet reports whether {current} carries a safeboot value. When
+// bcdedit can't be asked it assumes the flag is set, so clearing is tried.
+func safeBootIsSet(system string) bool {
+	out, err := exec.Command(filepath.Join(system, "bcdedit.exe"), "/enum", "{current}").Output()
+	if err != nil {
+		return true
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.EqualFold(fields[0], "safeboot") {
+			return true
+		}
+	}
+	return false
+}
+
+// runSystemTool runs name from the system directory by its full path, like
+// systemShutdownExe, and folds its output into the error.
+func runSystemTool(system, name string, args ...string) error {
+	out, err := exec.Command(filepath.Join(system, name), args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", strings.TrimSuffix(name, ".exe"), strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -2,6 +2,6 @@
 
 package main
 
-func maybeRunService() (bool, error) {
+func maybeRunService(cfg config) (bool, error) {
 	return false, nil
 }
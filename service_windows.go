@@ -5,16 +5,20 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 
 	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
 )
 
 const serviceName = "WindowsControl"
 
-type windowsService struct{}
+type windowsService struct {
+	cfg config
+}
 
-func maybeRunService() (bool, error) {
+func maybeRunService(cfg config) (bool, error) {
 	isService, err := svc.IsWindowsService()
 	if err != nil {
 		return false, err
@@ -22,10 +26,10 @@ func maybeRunService() (bool, error) {
 	if !isService {
 		return false, nil
 	}
-	return true, svc.Run(serviceName, &windowsService{})
+	return true, svc.Run(serviceName, &windowsService{cfg: cfg})
 }
 
-func (windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+func (s *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
 	const accepts = svc.AcceptStop | svc.AcceptShutdown
 
 	changes <- svc.Status{State: svc.StartPending}
@@ -35,7 +39,7 @@ func (windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes
 
 	done := make(chan error, 1)
 	go func() {
-		done <- runHTTPServer(ctx)
+		done <- runHTTPServer(ctx, s.cfg)
 	}()
 
 	status := svc.Status{State: svc.Running, Accepts: accepts}
@@ -44,11 +48,17 @@ func (windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes
 	for {
 		select {
 		case err := <-done:
+			status.State = svc.Stopped
+			status.Accepts = 0
 			if err != nil {
+				// Usually the port is taken or the TLS files are missing.
+				// Without the event log entry and the exit code, the SCM
+				// would only say the service stopped.
 				log.Printf("service server exited: %v", err)
+				logServiceError(err)
+				changes <- status
+				return true, 1
 			}
-			status.State = svc.Stopped
-			status.Accepts = 0
 			changes <- status
 			return false, 0
 		case change := <-r:
@@ -72,3 +82,17 @@ func (windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes
 		}
 	}
 }
+
+// logServiceError writes err to the Application event log under the
+// service's name.
+func logServiceError(err error) {
+	elog, openErr := eventlog.Open(serviceName)
+	if openErr != nil {
+		log.Printf("open event log: %v", openErr)
+		return
+	}
+	defer elog.Close()
+	if logErr := elog.Error(1, fmt.Sprintf("%s stopped: %v", serviceName, err)); logErr != nil {
+		log.Printf("write event log: %v", logErr)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+var errNoConsoleSession = errors.New("no user session is attached to the console")
+
+// sessionCommand runs an action against the console session. Immediate
+// requests run inline so failures reach the client; delayed ones go on a
+// server-side timer, since neither action has a delay of its own.
+func sessionCommand(action string, run func() error) powerCommand {
+	return func(req actionRequest) error {
+		if req.RestoreApps {
+			return errRestoreAppsNeedsRestart
+		}
+		if req.Comment != "" || req.Reason != "" {
+			return errReasonNeedsShutdown
+		}
+		if !consoleSessionActive() {
+			return &requestError{
+				status:  http.StatusConflict,
+				message: "Nobody is signed in at the console, so there is no session to " + action + ".",
+				code:    "no_console_session",
+			}
+		}
+		if req.DelaySeconds == 0 {
+			return run()
+		}
+		scheduleDeferred(action, time.Duration(req.DelaySeconds)*time.Second, func() {
+			if err := run(); err != nil {
+				log.Printf("%s failed: %v", action, err)
+			}
+		})
+		return nil
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func consoleSessionActive() bool {
+	return false
+}
+
+func lockConsoleSession() error {
+	return errors.ErrUnsupported
+}
+
+func logoffConsoleSession() error {
+	return errors.ErrUnsupported
+}
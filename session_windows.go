@@ -0,0 +1,90 @@
+//go:build windows
+
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+var (
+	moduser32                = windows.NewLazySystemDLL("user32.dll")
+	procLockWorkStation      = moduser32.NewProc("LockWorkStation")
+	procExitWindowsEx        = moduser32.NewProc("ExitWindowsEx")
+	modwtsapi32              = windows.NewLazySystemDLL("wtsapi32.dll")
+	procWTSDisconnectSession = modwtsapi32.NewProc("WTSDisconnectSession")
+	procWTSLogoffSession     = modwtsapi32.NewProc("WTSLogoffSession")
+)
+
+const ewxLogoff = 0x00000000
+
+// noConsoleSession is what WTSGetActiveConsoleSessionId returns while the
+// console is switching sessions or detached.
+const noConsoleSession = 0xFFFFFFFF
+
+// consoleSessionActive reports whether a user is signed in at the console.
+func consoleSessionActive() bool {
+	session := windows.WTSGetActiveConsoleSessionId()
+	if session == noConsoleSession {
+		return false
+	}
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(session, &token); err != nil {
+		// WTSQueryUserToken needs SeTcbPrivilege, which only the service
+		// holds. A console-mode server runs in the user's own session.
+		return !inServiceSession()
+	}
+	token.Close()
+	return true
+}
+
+// inServiceSession reports whether this process runs in session 0, where
+// services live and LockWorkStation can't reach the user's desktop.
+func inServiceSession() bool {
+	var session uint32
+	if err := windows.ProcessIdToSessionId(windows.GetCurrentProcessId(), &session); err != nil {
+		return false
+	}
+	return session == 0
+}
+
+// lockConsoleSession locks the workstation. The service can't call
+// LockWorkStation for another session, so it disconnects the console
+// session instead, which returns it to the lock screen with every
+// application still running.
+func lockConsoleSession() error {
+	if !inServiceSession() {
+		if ret, _, err := procLockWorkStation.Call(); ret == 0 {
+			return err
+		}
+		return nil
+	}
+	session := windows.WTSGetActiveConsoleSessionId()
+	if session == noConsoleSession {
+		return errNoConsoleSession
+	}
+	if ret, _, err := procWTSDisconnectSession.Call(0, uintptr(session), 0); ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// logoffConsoleSession signs out the console user. A console-mode server
+// runs inside that session and calls ExitWindowsEx, which stops the server
+// along with everything else; the service reaches across with
+// WTSLogoffSession.
+func logoffConsoleSession() error {
+	if !inServiceSession() {
+		if ret, _, err := procExitWindowsEx.Call(ewxLogoff, shutdownReasonPlanned); ret == 0 {
+			return err
+		}
+		return nil
+	}
+	session := windows.WTSGetActiveConsoleSessionId()
+	if session == noConsoleSession {
+		return errNoConsoleSession
+	}
+	if ret, _, err := procWTSLogoffSession.Call(0, uintptr(session), 0); ret == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+const (
+	defaultStorageWarningPercent  = 90
+	defaultStorageCriticalPercent = 97
+	// volumeQueryTimeout bounds each volume query so an unresponsive disk
+	// can't hang the request.
+	volumeQueryTimeout = 3 * time.Second
+)
+
+var errVolumeTimeout = errors.New("volume did not respond in time")
+
+// storageThresholds are the used percentages at which the system volume's
+// verdict turns to warning and critical.
+type storageThresholds struct {
+	warning  float64
+	critical float64
+}
+
+// storageLimits comes from the storageWarningPercent and
+// storageCriticalPercent settings.
+var storageLimits = storageThresholds{defaultStorageWarningPercent, defaultStorageCriticalPercent}
+
+// storageThresholds validates the configured thresholds. Zero keeps the
+// default, so either can be set on its own.
+func (c config) storageThresholds() (storageThresholds, error) {
+	limits := storageThresholds{defaultStorageWarningPercent, defaultStorageCriticalPercent}
+	if c.StorageWarningPercent != 0 {
+		limits.warning = c.StorageWarningPercent
+	}
+	if c.StorageCriticalPercent != 0 {
+		limits.critical = c.StorageCriticalPercent
+	}
+	if limits.warning <= 0 || limits.critical > 100 {
+		return storageThresholds{}, fmt.Errorf("storageWarningPercent and storageCriticalPercent must be between 0 and 100")
+	}
+	if limits.warning >= limits.critical {
+		return storageThresholds{}, fmt.Errorf("storageWarningPercent (%g) must be below storageCriticalPercent (%g)", limits.warning, limits.critical)
+	}
+	return limits, nil
+}
+
+type storageHealth struct {
+	Volume         string  `json:"volume"`
+	TotalBytes     uint64  `json:"totalBytes"`
+	FreeBytes      uint64  `json:"freeBytes"`
+	UsedPercent    float64 `json:"usedPercent"`
+	HiberfileBytes int64   `json:"hiberfileBytes"`
+	PagefileBytes  int64   `json:"pagefileBytes"`
+	Verdict        string  `json:"verdict"`
+}
+
+func storageHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if runtime.GOOS != "windows" {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"message": "Storage health reporting is available only on Windows hosts.",
+		})
+		return
+	}
+
+	health, err := queryWithTimeout(systemVolumeStorage, volumeQueryTimeout)
+	if errors.Is(err, errVolumeTimeout) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"message": "The system volume did not respond in time.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("query system volume: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to query the system volume.",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// queryWithTimeout runs query in the background and gives up after timeout.
+// The goroutine is left to finish on its own; its result is discarded.
+func queryWithTimeout(query func() (storageHealth, error), timeout time.Duration) (storageHealth, error) {
+	type result struct {
+		health storageHealth
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		health, err := query()
+		done <- result{health, err}
+	}()
+	select {
+	case res := <-done:
+		return res.health, res.err
+	case <-time.After(timeout):
+		return storageHealth{}, errVolumeTimeout
+	}
+}
+
+// fillStorageVerdict derives the used percentage and verdict from the raw
+// byte counts.
+func fillStorageVerdict(health *storageHealth) {
+	if health.TotalBytes > 0 {
+		used := health.TotalBytes - health.FreeBytes
+		health.UsedPercent = float64(used) * 100 / float64(health.TotalBytes)
+	}
+	switch {
+	case health.UsedPercent >= storageLimits.critical:
+		health.Verdict = "critical"
+	case health.UsedPercent >= storageLimits.warning:
+		health.Verdict = "warning"
+	default:
+		health.Verdict = "ok"
+	}
+}
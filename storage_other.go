@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func systemVolumeStorage() (storageHealth, error) {
+	return storageHealth{}, errors.ErrUnsupported
+}
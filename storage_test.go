@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFillStorageVerdict(t *testing.T) {
+	tests := []struct {
+		total, free uint64
+		want        string
+	}{
+		{0, 0, "ok"},
+		{10000, 5000, "ok"},
+		{10000, 1001, "ok"},
+		{10000, 1000, "warning"},
+		{10000, 301, "warning"},
+		{10000, 300, "critical"},
+		{10000, 0, "critical"},
+	}
+	for _, tt := range tests {
+		health := storageHealth{TotalBytes: tt.total, FreeBytes: tt.free}
+		fillStorageVerdict(&health)
+		if health.Verdict != tt.want {
+			t.Errorf("%d of %d free (%.2f%% used): verdict %s, want %s", tt.free, tt.total, health.UsedPercent, health.Verdict, tt.want)
+		}
+	}
+}
+
+func TestConfiguredStorageThresholds(t *testing.T) {
+	limits, err := config{StorageWarningPercent: 75}.storageThresholds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits != (storageThresholds{75, defaultStorageCriticalPercent}) {
+		t.Errorf("limits = %+v, want warning 75 and the default critical", limits)
+	}
+	saved := storageLimits
+	storageLimits = limits
+	t.Cleanup(func() { storageLimits = saved })
+
+	for free, want := range map[uint64]string{2600: "ok", 2500: "warning", 300: "critical"} {
+		health := storageHealth{TotalBytes: 10000, FreeBytes: free}
+		fillStorageVerdict(&health)
+		if health.Verdict != want {
+			t.Errorf("%d of 10000 free: verdict %s, want %s", free, health.Verdict, want)
+		}
+	}
+}
+
+func TestQueryWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	hung := func() (storageHealth, error) {
+		<-release
+		return storageHealth{}, nil
+	}
+	if _, err := queryWithTimeout(hung, 10*time.Millisecond); !errors.Is(err, errVolumeTimeout) {
+		t.Errorf("hung query: err = %v, want errVolumeTimeout", err)
+	}
+
+	failed := errors.New("device not ready")
+	if _, err := queryWithTimeout(func() (storageHealth, error) { return storageHealth{}, failed }, volumeQueryTimeout); !errors.Is(err, failed) {
+		t.Errorf("failing query: err = %v, want %v", err, failed)
+	}
+
+	health, err := queryWithTimeout(func() (storageHealth, error) { return storageHealth{Volume: `C:\`}, nil }, volumeQueryTimeout)
+	if err != nil || health.Volume != `C:\` {
+		t.Errorf("quick query = %+v, %v", health, err)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// systemVolumeStorage reports usage of the volume Windows boots from and
+// the size of the hibernation and paging files in its root.
+func systemVolumeStorage() (storageHealth, error) {
+	drive := os.Getenv("SystemDrive")
+	if drive == "" {
+		drive = "C:"
+	}
+	root := drive + `\`
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return storageHealth{}, err
+	}
+
+	var freeToCaller, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(rootPtr, &freeToCaller, &total, &free); err != nil {
+		return storageHealth{}, err
+	}
+
+	health := storageHealth{
+		Volume:     drive,
+		TotalBytes: total,
+		FreeBytes:  free,
+	}
+	if health.HiberfileBytes, err = fileSize(root + "hiberfil.sys"); err != nil {
+		return storageHealth{}, err
+	}
+	if health.PagefileBytes, err = fileSize(root + "pagefile.sys"); err != nil {
+		return storageHealth{}, err
+	}
+	fillStorageVerdict(&health)
+	return health, nil
+}
+
+// fileSize stats a system file, which works even while it is locked. A
+// missing file counts as zero bytes.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
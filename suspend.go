@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// suspendGrace is the shortest wait before suspending, even for immediate
+// requests, so the response reaches the client before the network drops.
+const suspendGrace = 2 * time.Second
+
+// suspendCommand checks that the machine supports the requested state and
+// arms the timer that suspends it. SetSuspendState has no delay of its own.
+func suspendCommand(hibernate bool) powerCommand {
+	return func(req actionRequest) error {
+		if req.RestoreApps {
+			return errRestoreAppsNeedsRestart
+		}
+		if req.Comment != "" || req.Reason != "" {
+			return errReasonNeedsShutdown
+		}
+		if !suspendAllowed(hibernate) {
+			if hibernate {
+				return &requestError{
+					status:  http.StatusConflict,
+					message: "Hibernation is disabled on this machine. Enable it with powercfg /hibernate on and try again.",
+					code:    "hibernate_unavailable",
+				}
+			}
+			return &requestError{
+				status:  http.StatusConflict,
+				message: "Sleep is not available on this machine. Modern Standby devices, for example, can't be put to sleep this way.",
+				code:    "sleep_unavailable",
+			}
+		}
+
+		// Sleep and hibernate share a slot: staging one replaces the other.
+		delay := max(time.Duration(req.DelaySeconds)*time.Second, suspendGrace)
+		scheduleDeferred("suspend", delay, func() {
+			if err := setSuspendState(hibernate); err != nil {
+				log.Printf("suspend (hibernate=%t) failed: %v", hibernate, err)
+			}
+		})
+		return nil
+	}
+}
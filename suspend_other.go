@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func suspendAllowed(hibernate bool) bool {
+	return false
+}
+
+func setSuspendState(hibernate bool) error {
+	return errors.ErrUnsupported
+}
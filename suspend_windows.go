@@ -0,0 +1,38 @@
+//go:build windows
+
+package main
+
+var (
+	procSetSuspendState       = modpowrprof.NewProc("SetSuspendState")
+	procIsPwrSuspendAllowed   = modpowrprof.NewProc("IsPwrSuspendAllowed")
+	procIsPwrHibernateAllowed = modpowrprof.NewProc("IsPwrHibernateAllowed")
+)
+
+// suspendAllowed reports whether the hardware and power policy allow the
+// state. IsPwrHibernateAllowed is false after powercfg /hibernate off, which
+// is what powercfg /a reports as "Hibernation has not been enabled".
+func suspendAllowed(hibernate bool) bool {
+	proc := procIsPwrSuspendAllowed
+	if hibernate {
+		proc = procIsPwrHibernateAllowed
+	}
+	ret, _, _ := proc.Call()
+	return ret != 0
+}
+
+func setSuspendState(hibernate bool) error {
+	if err := enablePrivilege("SeShutdownPrivilege"); err != nil {
+		return err
+	}
+	var hibernateArg uintptr
+	if hibernate {
+		hibernateArg = 1
+	}
+	// bForce is ignored since Vista; wake events stay enabled so scheduled
+	// tasks and Wake-on-LAN can still bring the machine back.
+	ret, _, err := procSetSuspendState.Call(hibernateArg, 0, 0)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// systemInfo is the GET /sysinfo response. Fields the platform can't report
+// are null.
+type systemInfo struct {
+	Hostname      string  `json:"hostname"`
+	OS            *string `json:"os"`
+	UptimeSeconds *int64  `json:"uptimeSeconds"`
+	BootedAt      *string `json:"bootedAt"`
+	// Sessions names who is signed in. Requests without the access token
+	// only get the counts.
+	Sessions           []userSession `json:"sessions"`
+	SessionCount       *int          `json:"sessionCount"`
+	ActiveSessionCount *int          `json:"activeSessionCount"`
+	Power              *powerStatus  `json:"power"`
+	RebootPending      *bool         `json:"rebootPending"`
+}
+
+// userSession is an interactive logon session.
+type userSession struct {
+	ID     uint32 `json:"id"`
+	User   string `json:"user"`
+	Domain string `json:"domain,omitempty"`
+	// State is "active" or "disconnected".
+	State string `json:"state"`
+	// Console is set for the session attached to the physical console.
+	Console bool `json:"console"`
+}
+
+type powerStatus struct {
+	// ACOnline is null when Windows doesn't know the AC line status.
+	ACOnline   *bool `json:"acOnline"`
+	HasBattery bool  `json:"hasBattery"`
+	// BatteryPercent is null without a battery or when it's unknown.
+	BatteryPercent *int `json:"batteryPercent"`
+	Charging       bool `json:"charging"`
+}
+
+// sysInfoCollector gathers the pieces of systemInfo. Methods return
+// errors.ErrUnsupported for what the platform can't report.
+type sysInfoCollector interface {
+	osVersion() (string, error)
+	uptime() (time.Duration, error)
+	sessions() ([]userSession, error)
+	powerStatus() (powerStatus, error)
+	rebootPending() (bool, error)
+}
+
+// sysInfo is the collector GET /sysinfo reads from.
+var sysInfo = newSysInfoCollector()
+
+func sysinfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	info := collectSystemInfo(sysInfo, time.Now())
+	if anonymousRead(r) {
+		info.Sessions = nil
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// collectSystemInfo fills in what c can report. A failing piece is logged
+// and left null rather than failing the whole response.
+func collectSystemInfo(c sysInfoCollector, now time.Time) systemInfo {
+	var info systemInfo
+	if hostname, err := os.Hostname(); err == nil {
+		info.Hostname = hostname
+	} else {
+		logCollectError("hostname", err)
+	}
+	if version, err := c.osVersion(); err == nil {
+		info.OS = &version
+	} else {
+		logCollectError("OS version", err)
+	}
+	if uptime, err := c.uptime(); err == nil {
+		seconds := int64(uptime / time.Second)
+		bootedAt := now.Add(-uptime).UTC().Format(time.RFC3339)
+		info.UptimeSeconds, info.BootedAt = &seconds, &bootedAt
+	} else {
+		logCollectError("uptime", err)
+	}
+	if sessions, err := c.sessions(); err == nil {
+		info.Sessions = sessions
+		if info.Sessions == nil {
+			info.Sessions = []userSession{}
+		}
+		total, active := len(sessions), 0
+		for _, session := range sessions {
+			if session.State == "active" {
+				active++
+			}
+		}
+		info.SessionCount, info.ActiveSessionCount = &total, &active
+	} else {
+		logCollectError("sessions", err)
+	}
+	if status, err := c.powerStatus(); err == nil {
+		info.Power = &status
+	} else {
+		logCollectError("power status", err)
+	}
+	if pending, err := c.rebootPending(); err == nil {
+		info.RebootPending = &pending
+	} else {
+		logCollectError("pending reboot", err)
+	}
+	return info
+}
+
+func logCollectError(what string, err error) {
+	if !errors.Is(err, errors.ErrUnsupported) {
+		log.Printf("sysinfo: %s: %v", what, err)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// portableCollector reports what non-Windows hosts have in common; the
+// session, power and servicing details are Windows concepts.
+type portableCollector struct{}
+
+func newSysInfoCollector() sysInfoCollector {
+	return portableCollector{}
+}
+
+func (portableCollector) osVersion() (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+func (portableCollector) uptime() (time.Duration, error) {
+	return systemUptime()
+}
+
+func (portableCollector) sessions() ([]userSession, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (portableCollector) powerStatus() (powerStatus, error) {
+	return powerStatus{}, errors.ErrUnsupported
+}
+
+func (portableCollector) rebootPending() (bool, error) {
+	return false, errors.ErrUnsupported
+}
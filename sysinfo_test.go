@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCollector answers every piece from its fields; a non-nil error in
+// errs fails that piece instead.
+type fakeCollector struct {
+	version  string
+	up       time.Duration
+	sessList []userSession
+	power    powerStatus
+	pending  bool
+	errs     map[string]error
+}
+
+func (f fakeCollector) osVersion() (string, error)        { return f.version, f.errs["os"] }
+func (f fakeCollector) uptime() (time.Duration, error)    { return f.up, f.errs["uptime"] }
+func (f fakeCollector) sessions() ([]userSession, error)  { return f.sessList, f.errs["sessions"] }
+func (f fakeCollector) powerStatus() (powerStatus, error) { return f.power, f.errs["power"] }
+func (f fakeCollector) rebootPending() (bool, error)      { return f.pending, f.errs["reboot"] }
+
+// captureLog collects the standard logger's output for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buf
+}
+
+func TestCollectSystemInfo(t *testing.T) {
+	logged := captureLog(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := fakeCollector{
+		version: "Windows 11 Pro 23H2",
+		up:      90 * time.Minute,
+		power:   powerStatus{HasBattery: true},
+		pending: true,
+	}
+	info := collectSystemInfo(c, now)
+
+	if info.OS == nil || *info.OS != c.version {
+		t.Errorf("os = %v, want %q", info.OS, c.version)
+	}
+	if info.UptimeSeconds == nil || *info.UptimeSeconds != 5400 {
+		t.Errorf("uptimeSeconds = %v, want 5400", info.UptimeSeconds)
+	}
+	if info.BootedAt == nil || *info.BootedAt != "2024-05-01T10:30:00Z" {
+		t.Errorf("bootedAt = %v, want 2024-05-01T10:30:00Z", info.BootedAt)
+	}
+	if info.Sessions == nil || len(info.Sessions) != 0 {
+		t.Errorf("sessions = %v, want an empty list rather than null", info.Sessions)
+	}
+	if info.SessionCount == nil || *info.SessionCount != 0 || info.ActiveSessionCount == nil || *info.ActiveSessionCount != 0 {
+		t.Errorf("session counts = %v, %v, want 0 and 0", info.SessionCount, info.ActiveSessionCount)
+	}
+	if info.Power == nil || !info.Power.HasBattery {
+		t.Errorf("power = %v", info.Power)
+	}
+	if info.RebootPending == nil || !*info.RebootPending {
+		t.Errorf("rebootPending = %v, want true", info.RebootPending)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("logged %q with nothing failing", logged)
+	}
+}
+
+func TestCollectSystemInfoFailures(t *testing.T) {
+	logged := captureLog(t)
+	c := fakeCollector{
+		version: "Windows 11 Pro 23H2",
+		errs: map[string]error{
+			"uptime":   errors.ErrUnsupported,
+			"sessions": errors.ErrUnsupported,
+			"power":    errors.New("GetSystemPowerStatus failed"),
+			"reboot":   errors.New("registry unavailable"),
+		},
+	}
+	info := collectSystemInfo(c, time.Now())
+
+	out, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(out, &payload); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"uptimeSeconds", "bootedAt", "sessions", "power", "rebootPending"} {
+		if value, ok := payload[field]; !ok || value != nil {
+			t.Errorf("%s = %v, want null", field, value)
+		}
+	}
+	if payload["os"] != c.version {
+		t.Errorf("os = %v; one failing piece must not hide the others", payload["os"])
+	}
+
+	for _, want := range []string{"power status: GetSystemPowerStatus failed", "pending reboot: registry unavailable"} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("log %q doesn't mention %q", logged, want)
+		}
+	}
+	for _, unsupported := range []string{"uptime", "sessions"} {
+		if strings.Contains(logged.String(), unsupported+":") {
+			t.Errorf("log %q reports unsupported %s as an error", logged, unsupported)
+		}
+	}
+}
+
+func TestSysinfoHidesSessionsWithoutToken(t *testing.T) {
+	saved := sysInfo
+	sysInfo = fakeCollector{sessList: []userSession{
+		{ID: 1, User: "alice", Domain: "HOME", State: "active", Console: true},
+		{ID: 2, User: "bob", Domain: "HOME", State: "disconnected"},
+	}}
+	t.Cleanup(func() { sysInfo = saved })
+	captureLog(t)
+
+	handler := requireToken("secret", newMux())
+	tests := []struct {
+		name          string
+		authorization string
+		wantNames     bool
+	}{
+		{"without token", "", false},
+		{"with token", "Bearer secret", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/sysinfo", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /sysinfo = %d, want 200", rec.Code)
+			}
+			var info systemInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(rec.Body.String(), "alice"); got != tt.wantNames {
+				t.Errorf("body names the signed-in users = %v, want %v: %s", got, tt.wantNames, rec.Body)
+			}
+			if info.SessionCount == nil || *info.SessionCount != 2 || info.ActiveSessionCount == nil || *info.ActiveSessionCount != 1 {
+				t.Errorf("session counts = %v, %v, want 2 and 1", info.SessionCount, info.ActiveSessionCount)
+			}
+		})
+	}
+}
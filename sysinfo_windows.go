@@ -0,0 +1,168 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	procGetTickCount64              = modkernel32.NewProc("GetTickCount64")
+	procGetSystemPowerStatus        = modkernel32.NewProc("GetSystemPowerStatus")
+	procWTSQuerySessionInformationW = modwtsapi32.NewProc("WTSQuerySessionInformationW")
+)
+
+// WTS_INFO_CLASS values for WTSQuerySessionInformationW.
+const (
+	wtsUserName   = 5
+	wtsDomainName = 7
+)
+
+// systemPowerStatus is SYSTEM_POWER_STATUS.
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+const (
+	batteryFlagCharging  = 8
+	batteryFlagNoBattery = 128
+	batteryUnknown       = 255
+)
+
+type windowsCollector struct{}
+
+func newSysInfoCollector() sysInfoCollector {
+	return windowsCollector{}
+}
+
+// osVersion combines the marketing name from the registry with the real
+// build number. ProductName still says "Windows 10" on Windows 11, so the
+// build decides.
+func (windowsCollector) osVersion() (string, error) {
+	version := windows.RtlGetVersion()
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	product, _, err := key.GetStringValue("ProductName")
+	if err != nil {
+		return "", err
+	}
+	if version.BuildNumber >= 22000 {
+		product = strings.Replace(product, "Windows 10", "Windows 11", 1)
+	}
+	if display, _, err := key.GetStringValue("DisplayVersion"); err == nil {
+		product += " " + display
+	}
+	return fmt.Sprintf("%s (build %d)", product, version.BuildNumber), nil
+}
+
+func (windowsCollector) uptime() (time.Duration, error) {
+	ms, _, _ := procGetTickCount64.Call()
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// sessions lists the sessions someone is signed in to. Session 0 and idle
+// logon screens have no user and are skipped.
+func (windowsCollector) sessions() ([]userSession, error) {
+	var infos *windows.WTS_SESSION_INFO
+	var count uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &infos, &count); err != nil {
+		return nil, err
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(infos)))
+
+	console := windows.WTSGetActiveConsoleSessionId()
+	var sessions []userSession
+	for _, info := range unsafe.Slice(infos, count) {
+		var state string
+		switch info.State {
+		case windows.WTSActive:
+			state = "active"
+		case windows.WTSDisconnected:
+			state = "disconnected"
+		default:
+			continue
+		}
+		user, err := sessionString(info.SessionID, wtsUserName)
+		if err != nil {
+			return nil, err
+		}
+		if user == "" {
+			continue
+		}
+		domain, err := sessionString(info.SessionID, wtsDomainName)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, userSession{
+			ID:      info.SessionID,
+			User:    user,
+			Domain:  domain,
+			State:   state,
+			Console: info.SessionID == console,
+		})
+	}
+	return sessions, nil
+}
+
+func sessionString(session uint32, class uintptr) (string, error) {
+	var buf *uint16
+	var size uint32
+	ret, _, err := procWTSQuerySessionInformationW.Call(0, uintptr(session), class, uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return "", err
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buf)))
+	return windows.UTF16PtrToString(buf), nil
+}
+
+func (windowsCollector) powerStatus() (powerStatus, error) {
+	var raw systemPowerStatus
+	if ret, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&raw))); ret == 0 {
+		return powerStatus{}, err
+	}
+	var status powerStatus
+	if raw.ACLineStatus != batteryUnknown {
+		online := raw.ACLineStatus == 1
+		status.ACOnline = &online
+	}
+	status.HasBattery = raw.BatteryFlag != batteryUnknown && raw.BatteryFlag&batteryFlagNoBattery == 0
+	if status.HasBattery {
+		status.Charging = raw.BatteryFlag&batteryFlagCharging != 0
+		if raw.BatteryLifePercent != batteryUnknown {
+			percent := int(raw.BatteryLifePercent)
+			status.BatteryPercent = &percent
+		}
+	}
+	return status, nil
+}
+
+// rebootPending checks the markers servicing and Windows Update leave until
+// the next restart.
+func (windowsCollector) rebootPending() (bool, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SOFTWARE\Microsoft\Windows\CurrentVersion\Component Based Servicing\RebootPending`,
+		registry.QUERY_VALUE)
+	if err == nil {
+		key.Close()
+		return true, nil
+	}
+	if !errors.Is(err, registry.ErrNotExist) {
+		return false, err
+	}
+	return updatesReadyToInstall()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	selfSignedCertName = "windowscontrol-cert.pem"
+	selfSignedKeyName  = "windowscontrol-key.pem"
+	// selfSignedValidity is long because the point of a persistent
+	// certificate is that clients pin it once.
+	selfSignedValidity = 10 * 365 * 24 * time.Hour
+)
+
+// tlsEnabled reports whether the server should speak HTTPS.
+func (c config) tlsEnabled() bool {
+	return c.TLSCert != "" || c.TLSSelfSigned
+}
+
+// serverCertificate loads the configured key pair or, in self-signed mode,
+// the persistent certificate next to the executable, creating it on first
+// run.
+func serverCertificate(cfg config) (tls.Certificate, error) {
+	if !cfg.TLSSelfSigned {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		return cert, nil
+	}
+	dir, err := selfSignedDir()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return loadOrCreateSelfSigned(filepath.Join(dir, selfSignedCertName), filepath.Join(dir, selfSignedKeyName))
+}
+
+// selfSignedDir is the executable's directory, like the default config file.
+// The service runs as LocalSystem, which can write there even under Program
+// Files.
+func selfSignedDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locate executable for the self-signed certificate: %w", err)
+	}
+	return filepath.Dir(exe), nil
+}
+
+// loadOrCreateSelfSigned reuses the certificate at certPath so its
+// fingerprint stays stable across restarts, and only generates a new one
+// when none exists yet or the old one has expired.
+func loadOrCreateSelfSigned(certPath, keyPath string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	switch {
+	case err == nil && time.Now().Before(cert.Leaf.NotAfter):
+		return cert, nil
+	case err == nil:
+		log.Printf("self-signed certificate %s expired on %s; generating a new one", certPath, cert.Leaf.NotAfter.Format(time.DateOnly))
+	case !errors.Is(err, fs.ErrNotExist):
+		return tls.Certificate{}, fmt.Errorf("load self-signed certificate: %w", err)
+	}
+
+	certPEM, keyPEM, err := generateSelfSigned(time.Now())
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate self-signed certificate: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, fmt.Errorf("save self-signed key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, fmt.Errorf("save self-signed certificate: %w", err)
+	}
+	log.Printf("generated self-signed certificate %s", certPath)
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateSelfSigned creates a P-256 certificate naming this machine's
+// hostname, localhost and every local address, so a browser shows the same
+// certificate whichever name or address it was reached by.
+func generateSelfSigned(now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "WindowsControl"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.Subject.CommonName = hostname
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// redirectToHTTPS answers plain HTTP requests with a permanent redirect to
+// the same host and path on httpsPort.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		target := "https://" + net.JoinHostPort(host, httpsPort) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
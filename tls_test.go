@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	now := time.Now()
+	certPEM, keyPEM, err := generateSelfSigned(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(keyPEM, []byte("PRIVATE KEY")) {
+		t.Fatal("key isn't PEM encoded")
+	}
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeKeyPair(t, certPath, keyPath, certPEM, keyPEM)
+	cert, err := loadOrCreateSelfSigned(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := cert.Leaf
+	if !slices.Contains(leaf.DNSNames, "localhost") {
+		t.Errorf("DNSNames = %v, want localhost among them", leaf.DNSNames)
+	}
+	for _, loopback := range []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback} {
+		if !slices.ContainsFunc(leaf.IPAddresses, loopback.Equal) {
+			t.Errorf("IPAddresses = %v, want %v among them", leaf.IPAddresses, loopback)
+		}
+	}
+	if leaf.NotAfter.Before(now.Add(selfSignedValidity - time.Minute)) {
+		t.Errorf("NotAfter = %v, want about %v from now", leaf.NotAfter, selfSignedValidity)
+	}
+	if !slices.Contains(leaf.ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		t.Error("certificate isn't for server auth")
+	}
+}
+
+func TestSelfSignedIsReusedAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first, err := loadOrCreateSelfSigned(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		t.Errorf("key file mode = %v, want it private", perm)
+	}
+	second, err := loadOrCreateSelfSigned(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Error("a new certificate was generated although the saved one is valid")
+	}
+}
+
+func TestExpiredSelfSignedIsReplaced(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM, keyPEM, err := generateSelfSigned(time.Now().Add(-selfSignedValidity - 24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeyPair(t, certPath, keyPath, certPEM, keyPEM)
+	cert, err := loadOrCreateSelfSigned(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !time.Now().Before(cert.Leaf.NotAfter) {
+		t.Fatalf("got the expired certificate back (NotAfter %v)", cert.Leaf.NotAfter)
+	}
+	saved, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(saved, certPEM) {
+		t.Error("the expired certificate wasn't replaced on disk")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		host, target, want string
+	}{
+		{"pc.lan:8080", "/status?x=1", "https://pc.lan:8443/status?x=1"},
+		{"pc.lan", "/", "https://pc.lan:8443/"},
+		{"192.168.1.20:8080", "/restart", "https://192.168.1.20:8443/restart"},
+		{"[fe80::1]:8080", "/", "https://[fe80::1]:8443/"},
+		{"[fd7a::5]", "/events", "https://[fd7a::5]:8443/events"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		r.Host = tt.host
+		rec := httptest.NewRecorder()
+		redirectToHTTPS("8443").ServeHTTP(rec, r)
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s%s: status %d, want 301", tt.host, tt.target, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s%s: Location = %s, want %s", tt.host, tt.target, got, tt.want)
+		}
+	}
+}
+
+func writeKeyPair(t *testing.T, certPath, keyPath string, certPEM, keyPEM []byte) {
+	t.Helper()
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
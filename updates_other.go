@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+func updatesReadyToInstall() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// updatesReadyToInstall reports whether Windows Update has staged updates
+// that need a restart to finish, which is when the Start menu offers
+// "Update and restart".
+func updatesReadyToInstall() (bool, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired`,
+		registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	key.Close()
+	return true, nil
+}
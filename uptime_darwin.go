@@ -0,0 +1,15 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func systemUptime() (time.Duration, error) {
+	boot, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(time.Unix(boot.Unix())), nil
+}
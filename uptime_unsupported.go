@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+func systemUptime() (time.Duration, error) {
+	return 0, errors.ErrUnsupported
+}
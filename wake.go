@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// powerTroubleshooterQuery selects the most recent "system returned from a
+// low power state" event, which records what woke the machine.
+const powerTroubleshooterQuery = "*[System[Provider[@Name='Microsoft-Windows-Power-Troubleshooter'] and (EventID=1)]]"
+
+// errNoWakeEvent means the log holds no wake event, as opposed to one that
+// couldn't be read.
+var errNoWakeEvent = errors.New("no wake event has been recorded since the log was cleared")
+
+type wakeSource struct {
+	Type   string `json:"type"`
+	Device string `json:"device,omitempty"`
+	WokeAt string `json:"wokeAt,omitempty"`
+}
+
+type powerTroubleshooterEvent struct {
+	Data []struct {
+		Name  string `xml:"Name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"EventData>Data"`
+}
+
+func wakeSourceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if runtime.GOOS != "windows" {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"message": "Wake source reporting is available only on Windows hosts.",
+		})
+		return
+	}
+
+	out, err := exec.Command("wevtutil", "qe", "System",
+		"/q:"+powerTroubleshooterQuery, "/c:1", "/rd:true", "/f:xml").Output()
+	if err != nil {
+		log.Printf("query wake event failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to query the system event log.",
+		})
+		return
+	}
+
+	source, err := parseWakeEvent(out)
+	if errors.Is(err, errNoWakeEvent) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("parse wake event: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to parse the wake event.",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, source)
+}
+
+// parseWakeEvent normalizes a Power-Troubleshooter event rendered by
+// wevtutil. WakeSourceType follows the PO_WAKE_SOURCE_TYPE enumeration.
+func parseWakeEvent(raw []byte) (wakeSource, error) {
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return wakeSource{}, errNoWakeEvent
+	}
+	var event powerTroubleshooterEvent
+	if err := xml.Unmarshal(raw, &event); err != nil {
+		return wakeSource{}, err
+	}
+
+	fields := make(map[string]string, len(event.Data))
+	for _, d := range event.Data {
+		fields[d.Name] = strings.TrimSpace(d.Value)
+	}
+
+	source := wakeSource{Type: "unknown", Device: fields["WakeSourceText"]}
+	if kind, err := strconv.Atoi(fields["WakeSourceType"]); err == nil {
+		switch kind {
+		case 0:
+			source.Type = "device"
+		case 1:
+			source.Type = "powerButton"
+		case 2, 3:
+			source.Type = "timer"
+		}
+	}
+	if wokeAt, err := time.Parse(time.RFC3339Nano, fields["WakeTime"]); err == nil {
+		source.WokeAt = wokeAt.UTC().Format(time.RFC3339)
+	}
+	return source, nil
+}
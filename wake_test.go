@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseWakeEvent(t *testing.T) {
+	event := func(data string) []byte {
+		return []byte(`<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event"><System><Provider Name="Microsoft-Windows-Power-Troubleshooter"/><EventID>1</EventID></System><EventData>` + data + `</EventData></Event>`)
+	}
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    wakeSource
+		wantErr error
+	}{
+		{
+			"device",
+			event(`<Data Name="WakeTime">2024-05-01T06:30:00.1234567Z</Data><Data Name="WakeSourceType">0</Data><Data Name="WakeSourceText">USB Keyboard</Data>`),
+			wakeSource{Type: "device", Device: "USB Keyboard", WokeAt: "2024-05-01T06:30:00Z"},
+			nil,
+		},
+		{"power button", event(`<Data Name="WakeSourceType">1</Data>`), wakeSource{Type: "powerButton"}, nil},
+		{"timer", event(`<Data Name="WakeSourceType">3</Data>`), wakeSource{Type: "timer"}, nil},
+		{"unknown type", event(`<Data Name="WakeSourceType">7</Data>`), wakeSource{Type: "unknown"}, nil},
+		{"no event", []byte("  \r\n"), wakeSource{}, errNoWakeEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWakeEvent(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseWakeEvent = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWakeEventMalformed(t *testing.T) {
+	_, err := parseWakeEvent([]byte(`<Event><EventData><Data Name="WakeSourceType">0</Data>`))
+	if err == nil || errors.Is(err, errNoWakeEvent) {
+		t.Errorf("err = %v, want a parse error distinct from errNoWakeEvent", err)
+	}
+}
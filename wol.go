@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// wolPort is the discard port magic packets are conventionally sent to.
+const wolPort = 9
+
+// wakeTarget is a machine the page offers to wake, from the config file.
+type wakeTarget struct {
+	Name string `json:"name"`
+	MAC  string `json:"mac"`
+}
+
+// wakeTargets is set from the config once at startup.
+var wakeTargets []wakeTarget
+
+func wakeTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	targets := wakeTargets
+	if targets == nil {
+		targets = []wakeTarget{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"targets": targets,
+	})
+}
+
+// wakeHandler sends a magic packet to a configured target or to a MAC given
+// in the body. Unlike the power actions it works on any platform, so an
+// always-on Linux box can wake the Windows machine it also shuts down.
+func wakeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Target string `json:"target"`
+		MAC    string `json:"mac"`
+	}
+	if r.Body != nil {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": fmt.Sprintf("invalid request body: %v", err),
+			})
+			return
+		}
+	}
+
+	name, mac := req.MAC, req.MAC
+	switch {
+	case req.Target != "" && req.MAC != "":
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": "send either target or mac, not both",
+		})
+		return
+	case req.Target != "":
+		target, ok := findWakeTarget(req.Target)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{
+				"message": fmt.Sprintf("Unknown wake target %q. GET /wake/targets lists the configured names.", req.Target),
+			})
+			return
+		}
+		name, mac = target.Name, target.MAC
+	case req.MAC == "":
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": "send a configured target name or a mac address",
+		})
+		return
+	}
+
+	hw, err := parseWakeMAC(mac)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	sent, err := sendMagicPacket(hw)
+	if sent == 0 {
+		log.Printf("send magic packet to %s: %v", hw, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "Failed to send the Wake-on-LAN packet.",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":     fmt.Sprintf("Wake-on-LAN packet sent to %s.", name),
+		"mac":         hw.String(),
+		"packetsSent": sent,
+	})
+}
+
+func findWakeTarget(name string) (wakeTarget, bool) {
+	for _, target := range wakeTargets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return wakeTarget{}, false
+}
+
+// parseWakeMAC accepts the usual colon, hyphen and dotted forms of a 48-bit
+// MAC address.
+func parseWakeMAC(value string) (net.HardwareAddr, error) {
+	hw, err := net.ParseMAC(value)
+	if err != nil || len(hw) != 6 {
+		return nil, fmt.Errorf("invalid MAC address %q: use the form AA:BB:CC:DD:EE:FF", value)
+	}
+	return hw, nil
+}
+
+// magicPacket builds the Wake-on-LAN payload: six 0xFF bytes followed by
+// the MAC repeated sixteen times.
+func magicPacket(mac net.HardwareAddr) []byte {
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	for i := 0; i < 16; i++ {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
+
+// sendMagicPacket broadcasts the packet on every IPv4 network this host is
+// attached to, since the limited broadcast address only leaves through one
+// interface on multi-homed hosts. It returns how many packets went out and
+// the last error, if any.
+func sendMagicPacket(mac net.HardwareAddr) (int, error) {
+	ips := broadcastAddresses()
+	if len(ips) == 0 {
+		ips = []net.IP{net.IPv4bcast}
+	}
+	destinations := make([]*net.UDPAddr, len(ips))
+	for i, ip := range ips {
+		destinations[i] = &net.UDPAddr{IP: ip, Port: wolPort}
+	}
+	return sendPackets(magicPacket(mac), destinations)
+}
+
+// sendPackets sends packet to each destination, returning how many went out
+// and the last error, if any.
+func sendPackets(packet []byte, destinations []*net.UDPAddr) (int, error) {
+	sent := 0
+	var lastErr error
+	for _, addr := range destinations {
+		conn, err := net.DialUDP("udp4", nil, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := conn.Write(packet); err != nil {
+			lastErr = err
+		} else {
+			sent++
+		}
+		conn.Close()
+	}
+	return sent, lastErr
+}
+
+// broadcastAddresses returns the directed broadcast address of each IPv4
+// network on an up, non-loopback interface that supports broadcast.
+func broadcastAddresses() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var addrs []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			ip, mask := ipNet.IP.To4(), ipNet.Mask
+			if len(mask) == net.IPv6len {
+				mask = mask[12:]
+			}
+			broadcast := make(net.IP, net.IPv4len)
+			for i := range broadcast {
+				broadcast[i] = ip[i] | ^mask[i]
+			}
+			addrs = append(addrs, broadcast)
+		}
+	}
+	return addrs
+}
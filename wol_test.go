@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseWakeMAC(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"AA:BB:CC:DD:EE:FF", "aa:bb:cc:dd:ee:ff", true},
+		{"aa-bb-cc-dd-ee-ff", "aa:bb:cc:dd:ee:ff", true},
+		{"aabb.ccdd.eeff", "aa:bb:cc:dd:ee:ff", true},
+		{"00:11:22:33:44", "", false},
+		{"00:11:22:33:44:55:66:77", "", false},
+		{"zz:11:22:33:44:55", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		hw, err := parseWakeMAC(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseWakeMAC(%q) error = %v, want ok %v", tt.value, err, tt.ok)
+			continue
+		}
+		if tt.ok && hw.String() != tt.want {
+			t.Errorf("parseWakeMAC(%q) = %s, want %s", tt.value, hw, tt.want)
+		}
+	}
+}
+
+// TestMagicPacketOnTheWire sends a packet to a local listener and checks
+// the payload that arrives.
+func TestMagicPacketOnTheWire(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	mac, err := parseWakeMAC("01:23:45:67:89:ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := sendPackets(magicPacket(mac), []*net.UDPAddr{listener.LocalAddr().(*net.UDPAddr)})
+	if sent != 1 || err != nil {
+		t.Fatalf("sendPackets = %d, %v", sent, err)
+	}
+
+	buf := make([]byte, 1024)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := buf[:n]
+	if len(payload) != 6+16*6 {
+		t.Fatalf("payload is %d bytes, want 102", len(payload))
+	}
+	if !bytes.Equal(payload[:6], bytes.Repeat([]byte{0xff}, 6)) {
+		t.Errorf("payload starts with % x, want six 0xff bytes", payload[:6])
+	}
+	for i := 0; i < 16; i++ {
+		if got := payload[6+i*6 : 12+i*6]; !bytes.Equal(got, mac) {
+			t.Errorf("repetition %d is % x, want % x", i, got, []byte(mac))
+		}
+	}
+}